@@ -0,0 +1,442 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// astarState is a game state under known weather, the traveler walking toward
+// target has remaining days to go
+type astarState struct {
+	date      int
+	node      string
+	target    string
+	remaining int
+	food      int
+	water     int
+	money     int
+	arrived   bool
+	first     bool
+	shopped   bool
+}
+
+type astarNode struct {
+	state   astarState
+	g       int // cost paid to reach state
+	f       int // g plus heuristic estimation of cost left
+	parent  *astarNode
+	command string // command bringing parent to this state
+	index   int
+	pruned  bool // dominated by another node found later
+}
+
+type astarQueue []*astarNode
+
+func (q astarQueue) Len() int { return len(q) }
+func (q astarQueue) Less(i, j int) bool {
+	if q[i].f != q[j].f {
+		return q[i].f < q[j].f
+	}
+	return q[i].g > q[j].g
+}
+func (q astarQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *astarQueue) Push(x interface{}) {
+	node := x.(*astarNode)
+	node.index = len(*q)
+	*q = append(*q, node)
+}
+func (q *astarQueue) Pop() interface{} {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
+
+// astarHeuristic estimates cost left from state to the ending, it must never
+// overestimate for the path found to be optimal
+type astarHeuristic func(a *astarSearch, s astarState) int
+
+var heuristicMap = map[string]astarHeuristic{
+	"none":        func(_ *astarSearch, _ astarState) int { return 0 },
+	"distance":    (*astarSearch).distanceCost,
+	"consumption": (*astarSearch).consumptionCost,
+	"both": func(a *astarSearch, s astarState) int {
+		return a.distanceCost(s) + a.consumptionCost(s)
+	},
+	"horizon": (*astarSearch).horizonCost,
+}
+
+// astarSearch finds the best plan under known weather. With money goal each
+// day not spent mining costs baseIncome, so that minimizing cost maximizes
+// final money with every step cost non-negative. With survival goal mining is
+// not considered and cost is money spent on supplies.
+type astarSearch struct {
+	*Traveler
+	money     bool
+	step      int
+	heuristic astarHeuristic
+	dist      map[string]int
+	least     map[ResourceType]int // daily consumption under the mildest weather
+	expanded  int
+	generated int
+	elapsed   time.Duration
+}
+
+type astarResult struct {
+	commands []string
+	state    astarState
+}
+
+func newAStarSearch(t *Traveler, money bool, heuristic astarHeuristic, step int) (*astarSearch, error) {
+	if !t.knowsAllWeather() {
+		return nil, fmt.Errorf("A* search needs weather of all %d days, %d known with visibility %s", t.dayCount, len(t.weatherList), t.config.visibility)
+	}
+	dist, _ := t.shortestFrom(t.ending.id, nil)
+	least := map[ResourceType]int{}
+	for _, kind := range []ResourceType{resourceFood, resourceWater} {
+		least[kind] = t.resourceBaseCost[weatherKinds[0]][kind]
+		for _, weather := range weatherKinds {
+			if t.resourceBaseCost[weather][kind] < least[kind] {
+				least[kind] = t.resourceBaseCost[weather][kind]
+			}
+		}
+	}
+	return &astarSearch{Traveler: t, money: money, step: step, heuristic: heuristic, dist: dist, least: least}, nil
+}
+
+// daysLeft returns shortest walking days from state to the ending
+func (a *astarSearch) daysLeft(s astarState) (int, bool) {
+	if s.remaining > 0 {
+		d, ok := a.dist[s.target]
+		return d + s.remaining, ok
+	}
+	d, ok := a.dist[s.node]
+	return d, ok
+}
+
+// distanceCost counts income lost on days walking to the ending
+func (a *astarSearch) distanceCost(s astarState) int {
+	if !a.money {
+		return 0
+	}
+	d, _ := a.daysLeft(s)
+	return d * a.baseIncome
+}
+
+// consumptionCost prices resource still lacking for walking to the ending under
+// the mildest weather
+func (a *astarSearch) consumptionCost(s astarState) int {
+	lack, _ := a.walkingStock(s)
+	return lack
+}
+
+// walkingStock compares stock with resource needed for walking to the ending,
+// returning cost of resource lacking and the most value surplus stock may save
+func (a *astarSearch) walkingStock(s astarState) (int, int) {
+	d, _ := a.daysLeft(s)
+	multiplier := a.walkCost
+	if a.stayCost < multiplier {
+		multiplier = a.stayCost
+	}
+	lack, surplus := 0, 0
+	for _, kind := range []ResourceType{resourceFood, resourceWater} {
+		stock := s.food
+		if kind == resourceWater {
+			stock = s.water
+		}
+		if left := stock - d*multiplier*a.least[kind]; left < 0 {
+			lack -= left * a.resourceBasePrice[kind] * a.price(s)
+		} else {
+			surplus += left * a.resourceBasePrice[kind] * 2
+		}
+	}
+	return lack, surplus
+}
+
+// horizonCost adds to walking cost the days left before deadline, each of them
+// either loses income or pays for resource consumed by mining. Days after
+// arrival are already in cost of the ending state, so it is 0 there.
+func (a *astarSearch) horizonCost(s astarState) int {
+	if s.remaining == 0 && s.node == a.ending.id {
+		return 0
+	} else if !a.money {
+		return a.consumptionCost(s)
+	}
+	d, _ := a.daysLeft(s)
+	lack, surplus := a.walkingStock(s)
+	daily := a.baseIncome
+	mining := a.mineCost * a.price(s) * (a.least[resourceFood]*a.resourceBasePrice[resourceFood] +
+		a.least[resourceWater]*a.resourceBasePrice[resourceWater])
+	if mining < daily {
+		daily = mining
+	}
+	extra := (a.dayCount-s.date-d)*daily - surplus
+	if extra < 0 {
+		extra = 0
+	}
+	return d*a.baseIncome + lack + extra
+}
+
+// price returns multiplier of base price for purchases from state on
+func (a *astarSearch) price(s astarState) int {
+	if s.first {
+		return 1
+	}
+	return 2
+}
+
+func (a *astarSearch) canBuy(s astarState) bool {
+	return a.nodes[s.node].nodeType == villageNode || (s.node == a.starting.id && s.first)
+}
+
+func (a *astarSearch) start() astarState {
+	t := a.Traveler
+	s := astarState{
+		date:    t.date,
+		node:    t.position,
+		food:    t.food,
+		water:   t.water,
+		money:   t.money,
+		arrived: t.arrivalDate == t.date,
+		first:   t.firstBuy,
+	}
+	s.shopped = !a.canBuy(s)
+	return s
+}
+
+// consume spends resource of the day with multiplier and moves on to next day,
+// reporting whether traveler survives it
+func (a *astarSearch) consume(s *astarState, multiplier int) bool {
+	weather, err := a.weatherOn(s.date)
+	if err != nil {
+		return false
+	}
+	s.food -= a.resourceBaseCost[weather][resourceFood] * multiplier
+	s.water -= a.resourceBaseCost[weather][resourceWater] * multiplier
+	s.date++
+	s.arrived = false
+	s.shopped = true
+	return s.food >= 0 && s.water >= 0
+}
+
+// successors lists states reachable by one command along with the command and
+// its cost
+func (a *astarSearch) successors(s astarState, emit func(astarState, string, int)) {
+	if s.date >= a.dayCount {
+		return
+	}
+	daily := 0
+	if a.money {
+		daily = a.baseIncome
+	}
+	if !s.shopped {
+		next := s
+		next.shopped = true
+		emit(next, "", 0)
+		used := s.food*a.resourceWeight[resourceFood] + s.water*a.resourceWeight[resourceWater]
+		price := a.price(s)
+		for food := 0; used+food*a.resourceWeight[resourceFood] <= a.load; food += a.step {
+			for water := 0; used+food*a.resourceWeight[resourceFood]+water*a.resourceWeight[resourceWater] <= a.load; water += a.step {
+				cost := price * (food*a.resourceBasePrice[resourceFood] + water*a.resourceBasePrice[resourceWater])
+				if food+water == 0 {
+					continue
+				} else if cost > s.money {
+					break
+				}
+				next := s
+				next.food, next.water, next.money = s.food+food, s.water+water, s.money-cost
+				next.first, next.shopped = false, true
+				emit(next, fmt.Sprintf("buy food:%d water:%d", food, water), cost)
+			}
+		}
+		return
+	}
+	if s.remaining > 0 {
+		a.walk(s, emit, daily)
+		return
+	}
+	next := s
+	if a.consume(&next, a.stayCost) {
+		next.shopped = !a.canBuy(next)
+		emit(next, "stay", daily)
+	}
+	if a.money && a.nodes[s.node].nodeType == mineNode && (!s.arrived || a.arrivalMining) {
+		next := s
+		if a.consume(&next, a.mineCost) {
+			next.money += a.baseIncome
+			next.shopped = !a.canBuy(next)
+			emit(next, "mine", daily-a.baseIncome)
+		}
+	}
+	for _, id := range a.moveCandidates(s.node) {
+		next := s
+		next.target, next.remaining = id, a.weight(s.node, id)
+		a.walk(next, emit, daily)
+	}
+}
+
+// walk advances a day toward target, or arrives at once along zero weight path
+func (a *astarSearch) walk(s astarState, emit func(astarState, string, int), daily int) {
+	command := ""
+	if s.node != s.target && s.target != "" {
+		command = "go " + s.target
+	}
+	next := s
+	if next.remaining == 0 {
+		next.node, next.target, next.arrived = s.target, "", true
+		next.shopped = !a.canBuy(next)
+		emit(next, command, 0)
+		return
+	}
+	weather, err := a.weatherOn(s.date)
+	if err != nil {
+		return
+	}
+	multiplier := a.walkCost
+	if weather == sandStorm && !a.sandMovable {
+		multiplier = a.stayCost
+	} else {
+		next.remaining--
+	}
+	if !a.consume(&next, multiplier) {
+		return
+	}
+	if next.remaining == 0 {
+		next.node, next.target = s.target, ""
+		next.shopped = !a.canBuy(next)
+	}
+	emit(next, command, daily)
+}
+
+// search runs A* from traveler's state. States differing only in stock and
+// cost are kept on a Pareto frontier, a state with no more food, water and no
+// less cost than another one is dropped.
+func (a *astarSearch) search() (*astarResult, error) {
+	begin := time.Now()
+	defer func() { a.elapsed = time.Since(begin) }()
+	frontier := map[astarState][]*astarNode{}
+	queue := &astarQueue{}
+	root := &astarNode{state: a.start()}
+	root.f = a.heuristic(a, root.state)
+	heap.Push(queue, root)
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(*astarNode)
+		if current.pruned {
+			continue
+		}
+		s := current.state
+		if s.remaining == 0 && s.node == a.ending.id {
+			return a.trace(current), nil
+		}
+		a.expanded++
+		a.successors(s, func(next astarState, command string, cost int) {
+			g := current.g + cost
+			if next.remaining == 0 && next.node == a.ending.id && a.money {
+				g += (a.dayCount - next.date) * a.baseIncome
+			}
+			if _, ok := a.daysLeft(next); !ok {
+				return
+			}
+			key := next
+			key.food, key.water, key.money = 0, 0, 0
+			kept := frontier[key][:0]
+			for _, other := range frontier[key] {
+				if other.state.food >= next.food && other.state.water >= next.water && other.g <= g {
+					return
+				} else if other.state.food <= next.food && other.state.water <= next.water && other.g >= g {
+					other.pruned = true
+				} else {
+					kept = append(kept, other)
+				}
+			}
+			node := &astarNode{state: next, g: g, f: g + a.heuristic(a, next), parent: current, command: command}
+			frontier[key] = append(kept, node)
+			a.generated++
+			heap.Push(queue, node)
+		})
+	}
+	return nil, fmt.Errorf("No surviving path to '%s'", a.ending.id)
+}
+
+// trace collects commands of path, merging days of walking toward a node
+func (a *astarSearch) trace(node *astarNode) *astarResult {
+	commands := []string{}
+	for n := node; n.parent != nil; n = n.parent {
+		if n.command == "" {
+			continue
+		}
+		if strings.HasPrefix(n.command, "go ") && n.parent.state.remaining > 0 {
+			continue
+		}
+		commands = append(commands, n.command)
+	}
+	for i, j := 0, len(commands)-1; i < j; i, j = i+1, j-1 {
+		commands[i], commands[j] = commands[j], commands[i]
+	}
+	return &astarResult{commands: commands, state: node.state}
+}
+
+// plan replays commands of an A* result day by day as a policy
+type plan struct {
+	days map[int][]string
+}
+
+func newPlan(t *Traveler, commands []string) (*plan, error) {
+	p := &plan{days: map[int][]string{}}
+	c := t.clone()
+	for _, command := range commands {
+		date := c.date
+		if err := c.apply(command); err != nil {
+			return nil, err
+		}
+		p.days[date] = append(p.days[date], command)
+	}
+	return p, nil
+}
+
+func (p *plan) decide(t *Traveler) []string {
+	return p.days[t.date]
+}
+
+func commandAStar(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	goal, heuristics, step := a.str("goal"), []string{a.str("heuristic")}, a.integer("step")
+	if step <= 0 {
+		return fmt.Errorf("step should be positive")
+	} else if heuristics[0] == "all" {
+		heuristics = []string{}
+		for name := range heuristicMap {
+			heuristics = append(heuristics, name)
+		}
+		sort.Strings(heuristics)
+	}
+	var result *astarResult
+	fmt.Print("| Heuristic | Expanded | Generated |     Time     | Money |\n")
+	for _, name := range heuristics {
+		search, err := newAStarSearch(t, goal == "money", heuristicMap[name], step)
+		if err != nil {
+			return err
+		}
+		result, err = search.search()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("|%11s|%10d|%11d|%14s|%7d|\n", name, search.expanded, search.generated, search.elapsed.Round(time.Microsecond), result.state.money)
+	}
+	fmt.Printf("Arrive at day %d with food %d, water %d, money %d\n",
+		result.state.date, result.state.food, result.state.water, result.state.money)
+	for _, command := range result.commands {
+		fmt.Println("  " + command)
+	}
+	p, err := newPlan(t, result.commands)
+	if err != nil {
+		return err
+	}
+	registerPolicy("astar", p)
+	return nil
+}
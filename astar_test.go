@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+// testTraveler loads a stage file with weather known to player
+func testTraveler(t *testing.T, file string) *Traveler {
+	t.Helper()
+	tr := newTraveler(file, SimulationConfig{money: -1, firstBuy: true})
+	if tr == nil {
+		t.Fatalf("cannot load %s", file)
+	}
+	return tr
+}
+
+func astarMoney(t *testing.T, tr *Traveler, heuristic string, step int) int {
+	t.Helper()
+	search, err := newAStarSearch(tr, true, heuristicMap[heuristic], step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := search.search()
+	if err != nil {
+		t.Fatalf("heuristic %s: %v", heuristic, err)
+	}
+	return result.state.money
+}
+
+func TestHeuristicsReachOptimum(t *testing.T) {
+	for _, file := range []string{"stage/stage1.txt", "stage/stage2.txt"} {
+		tr := testTraveler(t, file)
+		want := astarMoney(t, tr, "none", 100)
+		names := []string{}
+		for name := range heuristicMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if got := astarMoney(t, tr, name, 100); got != want {
+				t.Errorf("%s: heuristic %s reaches money %d, none reaches %d", file, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// argKind is the type an argument of command is checked against
+type argKind int
+
+const (
+	argString argKind = iota
+	argInt
+	argFloat
+	argNode // id of a node in graph
+)
+
+// commandParam is a positional argument or a name:value option of command
+type commandParam struct {
+	name    string
+	kind    argKind
+	value   string   // default value, empty for none
+	choices []string // values allowed, any if empty
+	// optional positional arguments may be left out from the end, a variadic
+	// one takes the rest of arguments and is last
+	optional bool
+	variadic bool
+}
+
+// commandSpec declares arguments of a shell command, which are checked by
+// the dispatcher before handler runs
+type commandSpec struct {
+	name    string
+	aliases []string
+	summary string
+	args    []commandParam
+	options []commandParam
+	// mutating commands act on traveler and are kept in history. Commands
+	// running other commands leave keeping history to those commands.
+	mutating bool
+	run      func(a *commandArgs, t *Traveler, states *StateRecorder) error
+}
+
+// commandArgs is arguments of command checked against its spec
+type commandArgs struct {
+	values map[string]string
+	lists  map[string][]string
+	given  map[string]bool
+}
+
+var commandSpecs = map[string]*commandSpec{}
+var commandAliases = map[string]*commandSpec{}
+
+func registerCommand(spec *commandSpec) {
+	commandSpecs[spec.name] = spec
+	commandAliases[spec.name] = spec
+	for _, alias := range spec.aliases {
+		commandAliases[alias] = spec
+	}
+}
+
+func findCommand(name string) (*commandSpec, error) {
+	spec, ok := commandAliases[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown command `%s`", name)
+	}
+	return spec, nil
+}
+
+// commandNames lists names of commands in order
+func commandNames() []string {
+	names := []string{}
+	for name := range commandSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *commandSpec) usage() string {
+	words := []string{s.name}
+	for _, p := range s.args {
+		name := p.name
+		if len(p.choices) > 0 {
+			name = strings.Join(p.choices, "|")
+		}
+		if p.variadic {
+			name += "..."
+		}
+		if p.optional {
+			words = append(words, "["+name+"]")
+		} else {
+			words = append(words, "<"+name+">")
+		}
+	}
+	for _, p := range s.options {
+		value := p.kind.String()
+		if len(p.choices) > 0 {
+			value = strings.Join(p.choices, "|")
+		}
+		words = append(words, fmt.Sprintf("[%s:%s]", p.name, value))
+	}
+	return strings.Join(words, " ")
+}
+
+func (k argKind) String() string {
+	switch k {
+	case argInt:
+		return "N"
+	case argFloat:
+		return "X"
+	case argNode:
+		return "node"
+	}
+	return "value"
+}
+
+func (s *commandSpec) option(name string) (commandParam, bool) {
+	for _, p := range s.options {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return commandParam{}, false
+}
+
+// check reports whether value fits kind and choices of parameter
+func (s *commandSpec) check(p commandParam, value string, t *Traveler) error {
+	switch p.kind {
+	case argInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s of `%s` should be an integer, not '%s'", p.name, s.name, value)
+		}
+	case argFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%s of `%s` should be a number, not '%s'", p.name, s.name, value)
+		}
+	case argNode:
+		if _, ok := t.nodes[value]; !ok {
+			return fmt.Errorf("No such node with id '%s'", value)
+		}
+	}
+	if len(p.choices) == 0 {
+		return nil
+	}
+	for _, choice := range p.choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s of `%s` should be one of %s, not '%s'", p.name, s.name, strings.Join(p.choices, ", "), value)
+}
+
+// parse checks arguments of command. An argument name:value sets option
+// name, unless command has no such option and the argument falls into a
+// variadic argument, as ranges of sweep do.
+func (s *commandSpec) parse(tokens []string, t *Traveler) (*commandArgs, error) {
+	a := &commandArgs{map[string]string{}, map[string][]string{}, map[string]bool{}}
+	for _, p := range s.options {
+		if p.value != "" {
+			a.values[p.name] = p.value
+		}
+	}
+	positional := []string{}
+	for _, token := range tokens {
+		parts := strings.SplitN(token, ":", 2)
+		if len(parts) == 2 {
+			if p, ok := s.option(parts[0]); ok {
+				if a.given[p.name] {
+					return nil, fmt.Errorf("Option '%s' of `%s` given twice", p.name, s.name)
+				} else if err := s.check(p, parts[1], t); err != nil {
+					return nil, err
+				}
+				a.values[p.name], a.given[p.name] = parts[1], true
+				continue
+			} else if !s.variadicAt(len(positional)) {
+				return nil, fmt.Errorf("Unknown option '%s' of `%s`, usage: %s", parts[0], s.name, s.usage())
+			}
+		}
+		positional = append(positional, token)
+	}
+	for i, p := range s.args {
+		if i >= len(positional) {
+			if !p.optional {
+				return nil, fmt.Errorf("Not enough argument for `%s`, usage: %s", s.name, s.usage())
+			} else if p.value != "" {
+				a.values[p.name] = p.value
+			}
+			continue
+		}
+		values := positional[i : i+1]
+		if p.variadic {
+			values = positional[i:]
+		}
+		for _, value := range values {
+			if err := s.check(p, value, t); err != nil {
+				return nil, err
+			}
+		}
+		a.values[p.name], a.lists[p.name], a.given[p.name] = values[0], values, true
+	}
+	if len(positional) > len(s.args) && !s.variadicAt(len(positional)) {
+		return nil, fmt.Errorf("Too much argument for `%s`, usage: %s", s.name, s.usage())
+	}
+	return a, nil
+}
+
+// variadicAt reports whether i-th positional argument falls into a variadic one
+func (s *commandSpec) variadicAt(i int) bool {
+	n := len(s.args)
+	return n > 0 && s.args[n-1].variadic && i >= n-1
+}
+
+func (a *commandArgs) has(name string) bool {
+	return a.given[name]
+}
+
+func (a *commandArgs) str(name string) string {
+	return a.values[name]
+}
+
+// integer and float read values checked by parse, so they do not fail
+func (a *commandArgs) integer(name string) int {
+	value, _ := strconv.Atoi(a.values[name])
+	return value
+}
+
+func (a *commandArgs) float(name string) float64 {
+	value, _ := strconv.ParseFloat(a.values[name], 64)
+	return value
+}
+
+func (a *commandArgs) list(name string) []string {
+	return a.lists[name]
+}
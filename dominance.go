@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DominanceRelation records that dominated node is never closer than dominant
+// node to any functional node, reasons hold the distance comparison
+type DominanceRelation struct {
+	dominant  string
+	dominated string
+	reasons   []string
+}
+
+// Dominance is result of dominated node analysis on a graph
+type Dominance struct {
+	relations []DominanceRelation
+	pruned    map[string]map[string]bool // pruned[x][y]: moving from x to y is never useful
+}
+
+func (g *Graph) isFunctional(id string) bool {
+	kind := g.nodes[id].nodeType
+	return kind == villageNode || kind == mineNode || kind == endingNode
+}
+
+// dominance finds for each pair of nodes x, y whether x is at least as close as
+// y to every village, mine and ending, and strictly closer to one of them. Once
+// traveler reaches x there is no reason to walk back to y. Functional nodes are
+// never considered dominated, as staying on them has its own use.
+func (g *Graph) dominance() *Dominance {
+	dist := g.allPairs()
+	functional := []string{}
+	for _, id := range g.sortedIDs() {
+		if g.isFunctional(id) {
+			functional = append(functional, id)
+		}
+	}
+	result := &Dominance{[]DominanceRelation{}, map[string]map[string]bool{}}
+	for _, x := range g.sortedIDs() {
+		for _, y := range g.sortedIDs() {
+			if x == y || g.isFunctional(y) {
+				continue
+			}
+			reasons, ok := dominates(dist[x], dist[y], functional)
+			if !ok {
+				continue
+			}
+			result.relations = append(result.relations, DominanceRelation{x, y, reasons})
+			pruned, ok := result.pruned[x]
+			if !ok {
+				pruned = map[string]bool{}
+			}
+			pruned[y] = true
+			result.pruned[x] = pruned
+		}
+	}
+	return result
+}
+
+func dominates(distX map[string]int, distY map[string]int, functional []string) ([]string, bool) {
+	reasons := []string{}
+	strict := false
+	for _, id := range functional {
+		dx, okX := distX[id]
+		dy, okY := distY[id]
+		if !okY {
+			continue
+		}
+		if !okX || dx > dy {
+			return nil, false
+		}
+		mark := "="
+		if dx < dy {
+			mark = "<"
+			strict = true
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %d %s %d", id, dx, mark, dy))
+	}
+	return reasons, strict
+}
+
+// allowed reports whether move from one node to another survives pruning, nil
+// dominance allows every move
+func (d *Dominance) allowed(from string, to string) bool {
+	if d == nil {
+		return true
+	}
+	return !d.pruned[from][to]
+}
+
+// moveCandidates returns nodes solvers should try moving to from node from,
+// skipping dominated ones when pruning is enabled
+func (t *Traveler) moveCandidates(from string) []string {
+	candidates := []string{}
+	for _, id := range t.neighbourIDs(from) {
+		if t.dominance.allowed(from, id) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates
+}
+
+func commandDominance(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
+	d := t.dominance
+	if d == nil {
+		d = t.Graph.dominance()
+	}
+	for _, relation := range d.relations {
+		fmt.Printf(
+			"%s dominates %s: %s\n",
+			relation.dominant, relation.dominated, strings.Join(relation.reasons, ", "),
+		)
+	}
+	fmt.Println("Pruned transitions:")
+	for _, id := range t.sortedIDs() {
+		for _, idn := range t.neighbourIDs(id) {
+			if !d.allowed(id, idn) {
+				fmt.Printf("\t%s -> %s\n", id, idn)
+			}
+		}
+	}
+	return nil
+}
@@ -47,3 +47,37 @@ const (
 var resourceMap = map[string]ResourceType{
 	"water": resourceWater, "food": resourceFood,
 }
+
+// Visibility enum for how much of weather list player can see
+type Visibility int8
+
+const (
+	visibleFull  Visibility = iota // weather of every day
+	visibleToday                   // weather of past days and today
+	visibleNone                    // weather of past days only
+)
+
+var visibilityMap = map[string]Visibility{
+	"full": visibleFull, "today": visibleToday, "none": visibleNone,
+}
+
+func (v Visibility) String() string {
+	return []string{"full", "today", "none"}[v]
+}
+
+// PreviewMode enum for what happens when a go command looks fatal
+type PreviewMode int8
+
+const (
+	previewOff     PreviewMode = iota // walk without preview
+	previewConfirm                    // show preview, ask before a fatal walk
+	previewStrict                     // show preview, reject a fatal walk
+)
+
+var previewMap = map[string]PreviewMode{
+	"off": previewOff, "confirm": previewConfirm, "strict": previewStrict,
+}
+
+func (p PreviewMode) String() string {
+	return []string{"off", "confirm", "strict"}[p]
+}
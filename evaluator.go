@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is named values measured in a single trial
+type Sample map[string]float64
+
+// Trial runs one evaluation on a traveler owned by the calling worker
+type Trial func(t *Traveler, rng *rand.Rand) Sample
+
+// Summary is aggregated result of a batch of trials
+type Summary struct {
+	runs int
+	sum  map[string]float64
+}
+
+func newSummary() *Summary {
+	return &Summary{0, map[string]float64{}}
+}
+
+func (s *Summary) add(sample Sample) {
+	s.runs++
+	for key, value := range sample {
+		s.sum[key] += value
+	}
+}
+
+func (s *Summary) merge(other *Summary) {
+	s.runs += other.runs
+	for key, value := range other.sum {
+		s.sum[key] += value
+	}
+}
+
+func (s *Summary) mean(key string) float64 {
+	if s.runs == 0 {
+		return 0
+	}
+	return s.sum[key] / float64(s.runs)
+}
+
+func (s *Summary) keys() []string {
+	keys := make([]string, 0, len(s.sum))
+	for key := range s.sum {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// evaluateBatch runs trial for count times over a pool of workers, each worker
+// gets its own clone of t. When ctx is cancelled, trials already finished are
+// still summarized and ctx.Err() is returned along with them.
+func evaluateBatch(ctx context.Context, t *Traveler, count int, workers int, trial Trial) (*Summary, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > count {
+		workers = count
+	}
+	jobs := make(chan struct{})
+	results := make(chan *Summary, workers)
+	seed := time.Now().UnixNano()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			local := t.clone()
+			rng := rand.New(rand.NewSource(seed + int64(worker)))
+			summary := newSummary()
+			for range jobs {
+				summary.add(trial(local, rng))
+			}
+			results <- summary
+		}(i)
+	}
+feed:
+	for i := 0; i < count; i++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- struct{}{}:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	total := newSummary()
+	for summary := range results {
+		total.merge(summary)
+	}
+	return total, ctx.Err()
+}
+
+// interruptContext returns a context cancelled when user press Ctrl-C, calling
+// cancel function stops listening for the signal.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// expressionFields are fields of traveler an expression reads by name
+var expressionFields = map[string]func(t *Traveler) int{
+	"date":  func(t *Traveler) int { return t.date },
+	"food":  func(t *Traveler) int { return t.food },
+	"water": func(t *Traveler) int { return t.water },
+	"money": func(t *Traveler) int { return t.money },
+	"load":  func(t *Traveler) int { return t.loadSpace },
+	"days":  func(t *Traveler) int { return t.dayCount },
+}
+
+// expression is a compiled expression over state of traveler, comparisons
+// and logical operators give 1 for true and 0 for false
+type expression struct {
+	eval    func(t *Traveler) (float64, error)
+	boolean bool
+}
+
+func (e *expression) format(value float64) string {
+	if e.boolean {
+		return strconv.FormatBool(value != 0)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+var expressionToken = regexp.MustCompile(`^\s*([0-9]+(\.[0-9]+)?|[a-zA-Z_][a-zA-Z0-9_]*|<=|>=|==|!=|&&|\|\||[-+*/%()<>!,])`)
+
+// expressionArgument matches tokens inside a function call, whose arguments
+// are names like node ids, which may hold any character but separators
+var expressionArgument = regexp.MustCompile(`^\s*([^\s,()]+|[,()])`)
+
+var expressionName = regexp.MustCompile(`^[a-zA-Z_]`)
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseExpression compiles an expression like food/cost(today,food) or
+// date+dist(ed)<=days. Functions dist(node) gives days of walking to node,
+// cost(weather) load space and cost(weather,resource) boxes of resource a
+// day of staying takes, where weather can be today.
+func parseExpression(text string) (*expression, error) {
+	p := &expressionParser{}
+	inCall := false
+	for rest := text; strings.TrimSpace(rest) != ""; {
+		pattern := expressionToken
+		if inCall {
+			pattern = expressionArgument
+		}
+		match := pattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("Unexpected '%s' in expression", strings.TrimSpace(rest))
+		}
+		token := match[1]
+		if last := len(p.tokens) - 1; token == "(" && last >= 0 && expressionName.MatchString(p.tokens[last]) {
+			inCall = true
+		} else if token == ")" {
+			inCall = false
+		}
+		p.tokens = append(p.tokens, token)
+		rest = rest[len(match[0]):]
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("Empty expression")
+	}
+	e, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	} else if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected '%s' in expression", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *expressionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("Expected '%s' in expression, got '%s'", token, got)
+	}
+	return nil
+}
+
+// binaryLevels lists binary operators from the loosest binding on
+var binaryLevels = [][]string{
+	{"||"}, {"&&"}, {"<", "<=", ">", ">=", "==", "!="}, {"+", "-"}, {"*", "/", "%"},
+}
+
+func (p *expressionParser) binary(level int) (*expression, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, candidate := range binaryLevels[level] {
+			found = found || op == candidate
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = combine(op, left, right)
+	}
+}
+
+func combine(op string, left *expression, right *expression) *expression {
+	apply := map[string]func(a, b float64) (float64, error){
+		"+": func(a, b float64) (float64, error) { return a + b, nil },
+		"-": func(a, b float64) (float64, error) { return a - b, nil },
+		"*": func(a, b float64) (float64, error) { return a * b, nil },
+		"/": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("Division by zero")
+			}
+			return a / b, nil
+		},
+		"%": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("Division by zero")
+			}
+			return math.Mod(a, b), nil
+		},
+		"<":  func(a, b float64) (float64, error) { return truth(a < b), nil },
+		"<=": func(a, b float64) (float64, error) { return truth(a <= b), nil },
+		">":  func(a, b float64) (float64, error) { return truth(a > b), nil },
+		">=": func(a, b float64) (float64, error) { return truth(a >= b), nil },
+		"==": func(a, b float64) (float64, error) { return truth(a == b), nil },
+		"!=": func(a, b float64) (float64, error) { return truth(a != b), nil },
+		"&&": func(a, b float64) (float64, error) { return truth(a != 0 && b != 0), nil },
+		"||": func(a, b float64) (float64, error) { return truth(a != 0 || b != 0), nil },
+	}[op]
+	return &expression{
+		eval: func(t *Traveler) (float64, error) {
+			a, err := left.eval(t)
+			if err != nil {
+				return 0, err
+			}
+			b, err := right.eval(t)
+			if err != nil {
+				return 0, err
+			}
+			return apply(a, b)
+		},
+		boolean: !strings.ContainsAny(op, "+-*/%"),
+	}
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *expressionParser) unary() (*expression, error) {
+	switch p.peek() {
+	case "-", "!":
+		op := p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &expression{
+			eval: func(t *Traveler) (float64, error) {
+				value, err := operand.eval(t)
+				if op == "-" {
+					return -value, err
+				}
+				return truth(value == 0), err
+			},
+			boolean: op == "!",
+		}, nil
+	case "(":
+		p.next()
+		e, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	return p.primary()
+}
+
+func (p *expressionParser) primary() (*expression, error) {
+	token := p.next()
+	if token == "" {
+		return nil, fmt.Errorf("Expression ends too early")
+	} else if value, err := strconv.ParseFloat(token, 64); err == nil {
+		return &expression{eval: func(*Traveler) (float64, error) { return value, nil }}, nil
+	}
+	if p.peek() == "(" {
+		return p.call(token)
+	}
+	field, ok := expressionFields[token]
+	if !ok && !expressionName.MatchString(token) {
+		return nil, fmt.Errorf("Unexpected '%s' in expression", token)
+	} else if !ok {
+		names := []string{}
+		for name := range expressionFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown name '%s' in expression, should be one of %s", token, strings.Join(names, ", "))
+	}
+	return &expression{eval: func(t *Traveler) (float64, error) { return float64(field(t)), nil }}, nil
+}
+
+// call parses arguments of a function, which are names rather than values
+func (p *expressionParser) call(name string) (*expression, error) {
+	p.next()
+	args := []string{}
+	for p.peek() != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg := p.next()
+		if arg == "" {
+			return nil, p.expect(")")
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	switch {
+	case name == "dist" && len(args) == 1:
+		return &expression{eval: func(t *Traveler) (float64, error) {
+			if _, ok := t.nodes[args[0]]; !ok {
+				return 0, fmt.Errorf("No such node with id '%s'", args[0])
+			}
+			dist, _ := t.Graph.shortestFrom(t.position, nil)
+			days, ok := dist[args[0]]
+			if !ok {
+				return 0, fmt.Errorf("Node '%s' cannot be reached", args[0])
+			}
+			return float64(days), nil
+		}}, nil
+	case name == "cost" && (len(args) == 1 || len(args) == 2):
+		kinds := []ResourceType{resourceFood, resourceWater}
+		if len(args) == 2 {
+			kind, ok := resourceMap[args[1]]
+			if !ok {
+				return nil, fmt.Errorf("Unknown resource '%s'", args[1])
+			}
+			kinds = []ResourceType{kind}
+		}
+		return &expression{eval: func(t *Traveler) (float64, error) {
+			weather, ok := weatherMap[args[0]]
+			if args[0] == "today" {
+				weather, ok = t.observedWeather(t.date)
+				if !ok {
+					return 0, fmt.Errorf("Weather of today is hidden")
+				}
+			} else if !ok {
+				return 0, fmt.Errorf("Unknown weather '%s'", args[0])
+			}
+			total := 0
+			for _, kind := range kinds {
+				boxes := t.resourceBaseCost[weather][kind] * t.stayCost
+				if len(kinds) == 1 {
+					total += boxes
+				} else {
+					total += boxes * t.resourceWeight[kind]
+				}
+			}
+			return float64(total), nil
+		}}, nil
+	}
+	return nil, fmt.Errorf("Unknown function %s with %d arguments, should be dist(node), cost(weather) or cost(weather,resource)", name, len(args))
+}
+
+func commandEval(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	e, err := parseExpression(strings.Join(a.list("expression"), " "))
+	if err != nil {
+		return err
+	}
+	value, err := e.eval(t)
+	if err != nil {
+		return err
+	}
+	fmt.Println(e.format(value))
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestExpressionNodeArguments(t *testing.T) {
+	tr := newTraveler("stage/stage4.txt", SimulationConfig{money: -1})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	tr.weatherList = []WeatherType{sunny}
+	dist, _ := tr.Graph.shortestFrom(tr.position, nil)
+	for text, want := range map[string]float64{
+		"dist(m')":              float64(dist["m'"]),
+		"dist( v' )+dist(m)":    float64(dist["v'"] + dist["m"]),
+		"date+dist(m')<=days":   1,
+		"food/cost(today,food)": 0,
+	} {
+		e, err := parseExpression(text)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if got, err := e.eval(tr); err != nil {
+			t.Errorf("%s: %v", text, err)
+		} else if got != want {
+			t.Errorf("%s evaluates to %v, want %v", text, got, want)
+		}
+	}
+	if _, err := parseExpression("food'"); err == nil {
+		t.Errorf("Quote outside of function call is accepted")
+	}
+}
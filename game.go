@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gameHost runs a multiplayer game on a stage. Players connect over
+// WebSocket, the game starts once all of them joined, and each day host waits
+// for actions of every player before resolving them together. Players idle
+// past the timeout, or gone, stay for the day.
+type gameHost struct {
+	stage   *Stage
+	size    int           // number of players game starts with
+	idle    time.Duration // time players have to act each day
+	mu      sync.Mutex
+	players []*gamePlayer
+	inbox   chan gameInput
+	done    chan struct{} // closed once game is over
+}
+
+type gamePlayer struct {
+	name   string
+	conn   *wsConn
+	t      *Traveler
+	left   bool   // connection lost, player stays every day
+	path   string // node player is walking to, walks go on without action
+	walked int    // days walked on path
+}
+
+// gameInput is a message of player passed to host loop
+type gameInput struct {
+	player  int
+	command string
+	left    bool
+}
+
+// gameMessage is sent between host and players. Players send action with
+// command, host sends join, start, day, end and error.
+type gameMessage struct {
+	Type    string       `json:"type"`
+	Command string       `json:"command,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Player  int          `json:"player"`
+	Date    int          `json:"date"`
+	Weather string       `json:"weather,omitempty"` // weather of date, players see a day at a time
+	Players []playerJSON `json:"players,omitempty"`
+}
+
+type playerJSON struct {
+	Name    string    `json:"name"`
+	Action  string    `json:"action,omitempty"`
+	Idle    bool      `json:"idle,omitempty"`    // no action in time, stayed
+	Walking string    `json:"walking,omitempty"` // node player is on the way to
+	Error   string    `json:"error,omitempty"`
+	State   stateJSON `json:"state"`
+}
+
+func newGameHost(stage *Stage, size int, idle time.Duration) (*gameHost, error) {
+	if err := stage.check(); err != nil {
+		return nil, err
+	} else if size < 1 {
+		return nil, fmt.Errorf("Game needs at least one player")
+	}
+	return &gameHost{
+		stage: stage,
+		size:  size,
+		idle:  idle,
+		inbox: make(chan gameInput),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// ServeHTTP lets a player join with name given in query
+func (h *gameHost) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.players) == h.size {
+		http.Error(w, "Game is full", http.StatusConflict)
+		return
+	}
+	t, err := travelerOn(h.stage, SimulationConfig{money: -1, firstBuy: true, visibility: visibleToday})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conn, err := wsUpgrade(w, r)
+	if err != nil {
+		return
+	}
+	index := len(h.players)
+	if name == "" {
+		name = fmt.Sprintf("player%d", index+1)
+	}
+	h.players = append(h.players, &gamePlayer{name: name, conn: conn, t: t})
+	conn.writeJSON(gameMessage{Type: "join", Player: index})
+	go h.listen(index, conn)
+	if len(h.players) == h.size {
+		go h.run()
+	}
+}
+
+// listen passes messages of a player to host loop until connection is lost.
+// Messages that are not actions are answered with an error.
+func (h *gameHost) listen(index int, conn *wsConn) {
+	for {
+		in := gameInput{player: index}
+		data, err := conn.readMessage()
+		if err != nil {
+			in.left = true
+		} else {
+			var m gameMessage
+			if err := json.Unmarshal(data, &m); err != nil {
+				conn.writeJSON(gameMessage{Type: "error", Player: index, Error: fmt.Sprintf("Bad message: %v", err)})
+				continue
+			} else if m.Type != "action" {
+				conn.writeJSON(gameMessage{Type: "error", Player: index, Error: fmt.Sprintf("Unknown message type '%s'", m.Type)})
+				continue
+			}
+			in.command = m.Command
+		}
+		select {
+		case h.inbox <- in:
+		case <-h.done:
+			return
+		}
+		if in.left {
+			return
+		}
+	}
+}
+
+// active reports whether player still takes part in game
+func (p *gamePlayer) active() bool {
+	return p.t.ok && p.t.alive() && !p.t.finished()
+}
+
+func (h *gameHost) run() {
+	defer func() {
+		close(h.done)
+		for _, p := range h.players {
+			p.conn.close()
+		}
+	}()
+	date := h.players[0].t.date
+	h.broadcast(gameMessage{Type: "start", Date: date}, nil)
+	for date < h.stage.dayCount {
+		actions, idle := h.collect()
+		moves, who := []playerMove{}, []int{}
+		for i, p := range h.players {
+			if actions[i] != "" {
+				moves = append(moves, playerMove{t: p.t, action: actions[i], walked: p.walked})
+				who = append(who, i)
+			}
+		}
+		outcome := make([]playerJSON, len(h.players))
+		for j, r := range resolveDay(moves) {
+			p := h.players[who[j]]
+			p.t, p.path, p.walked = r.t, r.path, r.walked
+			outcome[who[j]] = playerJSON{Action: strings.Join(r.plan, ", "), Idle: idle[who[j]], Walking: r.path}
+			if r.err != nil {
+				outcome[who[j]].Error = r.err.Error()
+			}
+		}
+		date++
+		h.broadcast(gameMessage{Type: "day", Date: date}, func(i int, p *playerJSON) {
+			p.Action, p.Idle, p.Walking, p.Error = outcome[i].Action, outcome[i].Idle, outcome[i].Walking, outcome[i].Error
+		})
+		over := true
+		for _, p := range h.players {
+			over = over && !p.active()
+		}
+		if over {
+			break
+		}
+	}
+	h.broadcast(gameMessage{Type: "end", Date: date}, nil)
+}
+
+// collect waits for actions of the day from active players, checked as they
+// come so that players can correct them. Players without a valid action when
+// time is up stay, and those not taking part get none.
+func (h *gameHost) collect() ([]string, []bool) {
+	actions, idle := make([]string, len(h.players)), make([]bool, len(h.players))
+	pending := map[int]bool{}
+	for i, p := range h.players {
+		if p.active() && p.path != "" {
+			actions[i] = "go " + p.path
+		} else if p.active() && !p.left {
+			pending[i] = true
+		}
+	}
+	timer := time.NewTimer(h.idle)
+	defer timer.Stop()
+	for len(pending) > 0 {
+		select {
+		case in := <-h.inbox:
+			p := h.players[in.player]
+			if in.left {
+				p.left = true
+				delete(pending, in.player)
+				continue
+			}
+			var plan []string
+			var err error
+			if !pending[in.player] {
+				err = fmt.Errorf("No action is expected from you today")
+			} else if plan, err = dayPlan(p.t, in.command); err == nil {
+				actions[in.player] = strings.Join(plan, ", ")
+				delete(pending, in.player)
+				continue
+			}
+			p.conn.writeJSON(gameMessage{Type: "error", Player: in.player, Command: in.command, Error: err.Error()})
+		case <-timer.C:
+			pending = nil
+		}
+	}
+	for i, p := range h.players {
+		if p.active() && actions[i] == "" {
+			actions[i], idle[i] = "stay", true
+		}
+	}
+	return actions, idle
+}
+
+// broadcast sends message with states of all players to everyone, fill adds
+// to entry of each player
+func (h *gameHost) broadcast(m gameMessage, fill func(i int, p *playerJSON)) {
+	for i, p := range h.players {
+		entry := playerJSON{Name: p.name, State: stateOf(p.t)}
+		if fill != nil {
+			fill(i, &entry)
+		}
+		m.Players = append(m.Players, entry)
+	}
+	// weather of the day is the same for everyone, whoever is still playing
+	if m.Date < len(h.stage.weatherList) {
+		m.Weather = weatherNames[h.stage.weatherList[m.Date]]
+	}
+	for i, p := range h.players {
+		m.Player = i
+		if !p.left {
+			p.conn.writeJSON(m)
+		}
+	}
+}
+
+// hostGame serves a multiplayer game on stage file at /play
+func hostGame(addr string, stageFile string, size int, idle time.Duration) error {
+	stage, err := stageFromFile(stageFile)
+	if err != nil {
+		return err
+	}
+	h, err := newGameHost(stage, size, idle)
+	if err != nil {
+		return err
+	}
+	http.Handle("/play", h)
+	log.Printf("Hosting game for %d players on %s/play", size, addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+// gameClient is a player connected to a game host
+type gameClient struct {
+	conn   *wsConn
+	player int
+}
+
+// joinGame connects to host at address like ws://localhost:8090/play
+func joinGame(address string, name string) (*gameClient, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("name", name)
+	u.RawQuery = query.Encode()
+	conn, err := wsDial(u.String())
+	if err != nil {
+		return nil, err
+	}
+	var m gameMessage
+	if err := conn.readJSON(&m); err != nil {
+		conn.close()
+		return nil, err
+	} else if m.Type != "join" {
+		conn.close()
+		return nil, fmt.Errorf("Unexpected message '%s' on joining", m.Type)
+	}
+	return &gameClient{conn: conn, player: m.Player}, nil
+}
+
+// act sends plan of the day
+func (c *gameClient) act(command string) error {
+	return c.conn.writeJSON(gameMessage{Type: "action", Command: command})
+}
+
+// next waits for next message from host
+func (c *gameClient) next() (*gameMessage, error) {
+	m := &gameMessage{}
+	if err := c.conn.readJSON(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gameClient) close() error {
+	return c.conn.close()
+}
+
+func (m *gameMessage) String() string {
+	switch m.Type {
+	case "error":
+		return colorRed + m.Error + colorNone
+	case "join":
+		return fmt.Sprintf("Joined as player %d, waiting for others", m.Player+1)
+	}
+	title := map[string]string{"start": "Game starts on day %d", "day": "Day %d", "end": "Game over on day %d"}[m.Type]
+	lines := []string{fmt.Sprintf(title, m.Date)}
+	if m.Weather != "" {
+		lines[0] += ", weather " + m.Weather
+	}
+	for i, p := range m.Players {
+		s := p.State
+		line := fmt.Sprintf("  %-10s at %s, money %d, food %d, water %d", p.Name, s.Position, s.Money, s.Food, s.Water)
+		switch {
+		case !s.Alive:
+			line += ", dead"
+		case s.Finished:
+			line += ", arrived"
+		}
+		if p.Action != "" {
+			line += " after " + p.Action
+		}
+		if p.Walking != "" {
+			line += ", walking to " + p.Walking
+		}
+		if p.Idle {
+			line += " (idle)"
+		}
+		if p.Error != "" {
+			line += " (" + p.Error + ")"
+		}
+		if i == m.Player {
+			line = colorGreen + line + colorNone
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// playGame lets player in terminal join a game, every line read is the plan
+// of a day
+func playGame(address string, name string) error {
+	c, err := joinGame(address, name)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	fmt.Println(&gameMessage{Type: "join", Player: c.player})
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if err := c.act(scanner.Text()); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		m, err := c.next()
+		if err != nil {
+			return nil
+		}
+		fmt.Println(m)
+		if m.Type == "end" {
+			return nil
+		}
+	}
+}
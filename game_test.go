@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextOf reads messages of client until one of type kind
+func nextOf(t *testing.T, c *gameClient, kind string) *gameMessage {
+	t.Helper()
+	for {
+		m, err := c.next()
+		if err != nil {
+			t.Fatalf("Waiting for %s: %v", kind, err)
+		} else if m.Type == kind {
+			return m
+		}
+	}
+}
+
+func TestGameResolvesDayTogether(t *testing.T) {
+	stage, err := stageFromFile("stage/stage1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := newGameHost(stage, 3, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	address := "ws" + strings.TrimPrefix(server.URL, "http") + "/play"
+	clients := []*gameClient{}
+	for _, name := range []string{"a", "b", "idle"} {
+		c, err := joinGame(address, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.close()
+		clients = append(clients, c)
+	}
+	for _, c := range clients {
+		nextOf(t, c, "start")
+	}
+
+	// a message that is not JSON is answered, and player can still act
+	if err := clients[0].conn.writeFrame(wsText, []byte("{")); err != nil {
+		t.Fatal(err)
+	} else if m := nextOf(t, clients[0], "error"); !strings.HasPrefix(m.Error, "Bad message") {
+		t.Errorf("Error on bad message is '%s'", m.Error)
+	}
+	for _, c := range clients[:2] {
+		if err := c.act("buy food:100 water:100, go ed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := nextOf(t, clients[0], "day")
+	if len(day.Players) != 3 {
+		t.Fatalf("Day lists %d players", len(day.Players))
+	}
+	weather := stage.weatherList[0]
+	// two players on the same path both consume twice
+	food := 100 - 2*stage.walkCost*stage.resourceBaseCost[weather][resourceFood]
+	for _, p := range day.Players[:2] {
+		if p.State.Food != food || p.Walking != "ed" {
+			t.Errorf("%s has food %d walking to '%s', want %d walking to ed", p.Name, p.State.Food, p.Walking, food)
+		}
+	}
+	if idle := day.Players[2]; !idle.Idle || idle.Action != "stay" || idle.State.Position != "st" {
+		t.Errorf("Idle player took '%s' at %s, idle %v", idle.Action, idle.State.Position, idle.Idle)
+	}
+	if day.Weather != weatherNames[stage.weatherList[day.Date]] {
+		t.Errorf("Weather of day %d sent as '%s'", day.Date, day.Weather)
+	}
+
+	// walkers go on without action until they arrive
+	end := nextOf(t, clients[0], "end")
+	for _, p := range end.Players[:2] {
+		if !p.State.Finished {
+			t.Errorf("%s ends at %s, not arrived", p.Name, p.State.Position)
+		}
+	}
+}
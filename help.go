@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func commandHelp(a *commandArgs, _ *Traveler, _ *StateRecorder) error {
+	if a.has("command") {
+		spec, err := findCommand(a.str("command"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n\t%s\n", spec.usage(), spec.summary)
+		if len(spec.aliases) > 0 {
+			fmt.Printf("\tAlso called: %s\n", strings.Join(spec.aliases, ", "))
+		}
+		return nil
+	}
+	width := 0
+	for _, name := range commandNames() {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, name := range commandNames() {
+		fmt.Printf("%-*s  %s\n", width, name, commandSpecs[name].summary)
+	}
+	fmt.Println("\nCommands are separated by ';', see help <command> for usage")
+	return nil
+}
+
+// shellCompletion completes names of commands and macros for the first word
+// of a command, and choices, node ids and options declared in its spec after it
+func shellCompletion(t *Traveler, states *StateRecorder) func(string) []string {
+	return func(line string) []string {
+		if i := strings.LastIndex(line, ";"); i >= 0 {
+			line = line[i+1:]
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			names := commandNames()
+			for name := range states.macros {
+				names = append(names, name)
+			}
+			return names
+		}
+		spec, err := findCommand(words[0])
+		if err != nil {
+			return nil
+		}
+		// options are left out, the rest of words are positional arguments
+		position := 0
+		for _, word := range words[1:] {
+			if _, ok := spec.option(strings.SplitN(word, ":", 2)[0]); !ok {
+				position++
+			}
+		}
+		candidates := []string{}
+		for _, p := range spec.options {
+			candidates = append(candidates, p.name+":")
+		}
+		if position >= len(spec.args) && !spec.variadicAt(position) {
+			return candidates
+		}
+		p := spec.args[len(spec.args)-1]
+		if position < len(spec.args) {
+			p = spec.args[position]
+		}
+		switch {
+		case (spec.name == "repeat" || spec.name == "while") && p.name == "command":
+			// command repeated follows the number of times or condition
+			return shellCompletion(t, states)(strings.Join(words[2:], " "))
+		case spec.name == "help":
+			return commandNames()
+		case spec.name == "sweep":
+			for name := range sweepParams {
+				candidates = append(candidates, name+":")
+			}
+		case p.name == "policy":
+			candidates = append(candidates, policyNames()...)
+		case p.kind == argNode:
+			for id := range t.nodes {
+				candidates = append(candidates, id)
+			}
+		}
+		return append(candidates, p.choices...)
+	}
+}
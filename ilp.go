@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ilpMove is the decision of starting to walk from node to target on date
+type ilpMove struct {
+	variable int
+	from     int
+	to       int
+	date     int
+	days     int
+}
+
+// ilpArc is a decision taking traveler from a node on date to another one,
+// carrying stock left after its consumption as food and water variables
+type ilpArc struct {
+	variable int
+	from     int
+	to       int
+	date     int
+	days     int
+	food     int
+	water    int
+	consumeF float64
+	consumeW float64
+}
+
+// ilpNetwork is the time-expanded network of game under known weather.
+// Walking across an edge takes its weight in days plus days of sandstorm on the
+// way, when traveler stays unless walking in sandstorm is allowed. Purchases
+// at starting point are at base price, those at villages are at double price.
+// Stock flows along with the traveler on arcs instead of being a total of each
+// day, which keeps linear relaxation from sharing stock among fractional
+// routes.
+type ilpNetwork struct {
+	*lpModel
+	ids      []string
+	origin   int // node traveler starts at
+	end      int
+	begin    int
+	at       map[int]map[int]int // node, date to variable of being at node
+	stay     map[int]map[int]int
+	mine     map[int]map[int]int
+	food     map[int]map[int]int // node, date to units of food bought
+	water    map[int]map[int]int
+	moves    []ilpMove
+	arcs     []ilpArc
+	finish   map[int]int // date to variable of arriving at ending
+	money    map[int]int
+	deadline int
+	step     int // boxes of a unit of purchase variables
+}
+
+// timeExpanded builds the network, resource is bought in lots of step boxes
+func (t *Traveler) timeExpanded(step int) (*ilpNetwork, error) {
+	if !t.knowsAllWeather() {
+		return nil, fmt.Errorf("Time-expanded network needs weather of all %d days, %d known with visibility %s", t.dayCount, len(t.weatherList), t.config.visibility)
+	}
+	n := &ilpNetwork{
+		lpModel:  newLPModel("desert"),
+		ids:      t.sortedIDs(),
+		begin:    t.date,
+		deadline: t.dayCount,
+		step:     step,
+		at:       map[int]map[int]int{},
+		stay:     map[int]map[int]int{},
+		mine:     map[int]map[int]int{},
+		food:     map[int]map[int]int{},
+		water:    map[int]map[int]int{},
+		finish:   map[int]int{},
+		money:    map[int]int{},
+	}
+	// importing a solution rebuilds the network from the same start and step
+	n.comments = append(n.comments,
+		fmt.Sprintf("start node: %s", t.position), fmt.Sprintf("start date: %d", t.date), fmt.Sprintf("step: %d", step),
+	)
+	index := map[string]int{}
+	for k, id := range n.ids {
+		index[id] = k
+		n.comments = append(n.comments, fmt.Sprintf("node %d: %s", k, id))
+		n.at[k], n.stay[k], n.mine[k], n.food[k], n.water[k] = map[int]int{}, map[int]int{}, map[int]int{}, map[int]int{}, map[int]int{}
+	}
+	end := index[t.ending.id]
+	n.origin, n.end = index[t.position], end
+	// nodes out of reach on a day, or too far from ending, are left out
+	fromStart, _ := t.shortestFrom(t.position, nil)
+	toEnd, _ := t.shortestFrom(t.ending.id, nil)
+	reach := func(k int, date int) bool {
+		d1, ok1 := fromStart[n.ids[k]]
+		d2, ok2 := toEnd[n.ids[k]]
+		return ok1 && ok2 && t.date+d1 <= date && date+d2 <= t.dayCount
+	}
+	wF, wW := t.resourceWeight[resourceFood], t.resourceWeight[resourceWater]
+	arc := func(name string, from int, to int, date int, days int, multiplier func(date int) int) int {
+		a := ilpArc{from: from, to: to, date: date, days: days}
+		// days of arcs are checked to be within stage
+		for day := date; day < date+days; day++ {
+			weather, _ := t.weatherOn(day)
+			a.consumeF += float64(t.resourceBaseCost[weather][resourceFood] * multiplier(day))
+			a.consumeW += float64(t.resourceBaseCost[weather][resourceWater] * multiplier(day))
+		}
+		// load left after consumption bounds stock carried, arcs consuming more
+		// than load are never taken
+		spare := float64(t.load) - a.consumeF*float64(wF) - a.consumeW*float64(wW)
+		taken := 1.0
+		if spare < 0 {
+			taken, spare = 0, 0
+		}
+		a.variable = n.variable(name, lpBinary, 0, taken)
+		a.food = n.variable("f"+name, lpContinuous, 0, math.Floor(spare/float64(wF)))
+		a.water = n.variable("w"+name, lpContinuous, 0, math.Floor(spare/float64(wW)))
+		n.arcs = append(n.arcs, a)
+		return a.variable
+	}
+	stay := func(int) int { return t.stayCost }
+	mine := func(int) int { return t.mineCost }
+	walk := func(day int) int {
+		if weather, _ := t.weatherOn(day); weather == sandStorm && !t.sandMovable {
+			return t.stayCost
+		}
+		return t.walkCost
+	}
+	for date := t.date; date <= t.dayCount; date++ {
+		for k, id := range n.ids {
+			if !reach(k, date) {
+				continue
+			}
+			n.at[k][date] = n.variable(fmt.Sprintf("x_%d_%d", k, date), lpBinary, 0, 1)
+			if date == t.dayCount || k == end {
+				continue
+			}
+			// staying or mining keeps traveler at node on the next day, walks
+			// are checked at their own end
+			if reach(k, date+1) {
+				n.stay[k][date] = arc(fmt.Sprintf("s_%d_%d", k, date), k, k, date, 1, stay)
+				// traveler already on its arrival day cannot mine today
+				arrived := date == t.date && k == n.origin && t.arrivalDate == t.date
+				if t.nodes[id].nodeType == mineNode && (t.arrivalMining || !arrived) {
+					n.mine[k][date] = arc(fmt.Sprintf("m_%d_%d", k, date), k, k, date, 1, mine)
+				}
+			}
+			if t.nodes[id].nodeType == villageNode || (date == t.date && id == t.starting.id && t.firstBuy) {
+				n.food[k][date] = n.variable(fmt.Sprintf("bf_%d_%d", k, date), lpInteger, 0, float64(t.load/wF/step))
+				n.water[k][date] = n.variable(fmt.Sprintf("bw_%d_%d", k, date), lpInteger, 0, float64(t.load/wW/step))
+			}
+			for _, idn := range t.moveCandidates(id) {
+				days, ok := t.walkingDays(date, t.weight(id, idn))
+				if !ok || !reach(index[idn], date+days) {
+					continue
+				}
+				variable := arc(fmt.Sprintf("y_%d_%d_%d", k, index[idn], date), k, index[idn], date, days, walk)
+				n.moves = append(n.moves, ilpMove{variable, k, index[idn], date, days})
+			}
+		}
+		if v, ok := n.at[end][date]; ok {
+			n.finish[date] = v
+		}
+		if date == t.date {
+			n.money[date] = n.variable(fmt.Sprintf("M_%d", date), lpContinuous, float64(t.money), float64(t.money))
+		} else {
+			// bounding money keeps the relaxation well scaled
+			n.money[date] = n.variable(fmt.Sprintf("M_%d", date), lpContinuous, 0, float64(t.money+t.baseIncome*(date-t.date)))
+		}
+	}
+	n.objective = []lpTerm{{n.money[t.dayCount], 1}}
+	// money changes by income and lot prices only, plans differing in money
+	// differ by at least their common divisor
+	granularity := t.baseIncome
+	for _, price := range t.resourceBasePrice {
+		for a, b := granularity, price*step; b != 0; a, b = b, a%b {
+			granularity = b
+		}
+	}
+	if granularity > 0 {
+		n.granularity = float64(granularity)
+	}
+
+	finish := []lpTerm{}
+	for date := t.date; date <= t.dayCount; date++ {
+		if v, ok := n.finish[date]; ok {
+			finish = append(finish, lpTerm{v, 1})
+		}
+	}
+	n.constrain("finish", finish, "=", 1)
+	for _, a := range n.arcs {
+		// stock carried is within load, and nothing is carried off an arc not taken
+		n.constrain("load_"+n.variables[a.variable].name, []lpTerm{
+			{a.food, float64(wF)}, {a.water, float64(wW)},
+			{a.variable, a.consumeF*float64(wF) + a.consumeW*float64(wW) - float64(t.load)},
+		}, "<=", 0)
+	}
+	for date := t.date; date <= t.dayCount; date++ {
+		for k := range n.ids {
+			x, ok := n.at[k][date]
+			if !ok {
+				continue
+			}
+			in := []lpTerm{{x, 1}}
+			out := []lpTerm{{x, 1}}
+			inF, inW, outF, outW := []lpTerm{}, []lpTerm{}, []lpTerm{}, []lpTerm{}
+			sameDay := []lpTerm{}
+			for _, a := range n.arcs {
+				if a.to == k && a.date+a.days == date {
+					in = append(in, lpTerm{a.variable, -1})
+					inF, inW = append(inF, lpTerm{a.food, -1}), append(inW, lpTerm{a.water, -1})
+					if a.days == 0 {
+						sameDay = append(sameDay, lpTerm{a.variable, 1})
+					}
+				} else if a.from == k && a.date == date {
+					out = append(out, lpTerm{a.variable, -1})
+					outF = append(outF, lpTerm{a.food, 1}, lpTerm{a.variable, a.consumeF})
+					outW = append(outW, lpTerm{a.water, 1}, lpTerm{a.variable, a.consumeW})
+				}
+			}
+			// leaving node on the day, or dying at deadline before the ending
+			if k != end {
+				n.constrain(fmt.Sprintf("out_%d_%d", k, date), out, "=", 0)
+			}
+			// traveler is at its position on the first day, zero weight paths
+			// lead to other nodes on the same day
+			stockF, stockW, fixed := 0.0, 0.0, 0.0
+			if date == t.date && k == n.origin {
+				stockF, stockW, fixed = float64(t.food), float64(t.water), 1
+			}
+			n.constrain(fmt.Sprintf("in_%d_%d", k, date), in, "=", fixed)
+			if v, ok := n.mine[k][date]; ok && !t.arrivalMining && len(sameDay) > 0 {
+				n.constrain(fmt.Sprintf("arrival_%d_%d", k, date), append(sameDay, lpTerm{v, 1}), "<=", 1)
+			}
+			if k == end || date == t.dayCount {
+				continue
+			}
+			// stock leaving node is what arrives plus what is bought
+			if v, ok := n.food[k][date]; ok {
+				lot := -float64(step)
+				inF, inW = append(inF, lpTerm{v, lot}), append(inW, lpTerm{n.water[k][date], lot})
+			}
+			n.constrain(fmt.Sprintf("food_%d_%d", k, date), append(outF, inF...), "=", stockF)
+			n.constrain(fmt.Sprintf("water_%d_%d", k, date), append(outW, inW...), "=", stockW)
+		}
+		if date == t.dayCount {
+			continue
+		}
+		money := []lpTerm{{n.money[date+1], 1}, {n.money[date], -1}}
+		spend := []lpTerm{{n.money[date], 1}}
+		for k, id := range n.ids {
+			if v, ok := n.mine[k][date]; ok {
+				money = append(money, lpTerm{v, -float64(t.baseIncome)})
+			}
+			if v, ok := n.food[k][date]; ok {
+				price := 2.0
+				if id == t.starting.id && date == t.date && t.firstBuy {
+					price = 1
+				}
+				vw := n.water[k][date]
+				costF := price * float64(t.resourceBasePrice[resourceFood]*step)
+				costW := price * float64(t.resourceBasePrice[resourceWater]*step)
+				money = append(money, lpTerm{v, costF}, lpTerm{vw, costW})
+				spend = append(spend, lpTerm{v, -costF}, lpTerm{vw, -costW})
+			}
+		}
+		n.constrain(fmt.Sprintf("money_%d", date), money, "=", 0)
+		n.constrain(fmt.Sprintf("budget_%d", date), spend, ">=", 0)
+	}
+	// deciding day by day finds integral plans early
+	for _, days := range []map[int]map[int]int{n.at, n.stay, n.mine, n.food, n.water} {
+		for _, day := range days {
+			for date, v := range day {
+				n.variables[v].priority = date
+			}
+		}
+	}
+	for _, move := range n.moves {
+		n.variables[move.variable].priority = move.date
+	}
+	return n, nil
+}
+
+// walkingDays returns days taken by walking distance from date on, as moveTo
+// does, reporting false when it can not be done before deadline. Zero
+// distance takes no day.
+func (s *Stage) walkingDays(date int, distance int) (int, bool) {
+	days := 0
+	for distance > 0 {
+		weather, err := s.weatherOn(date + days)
+		if err != nil {
+			return 0, false
+		}
+		if weather != sandStorm || s.sandMovable {
+			distance--
+		}
+		days++
+	}
+	return days, true
+}
+
+// script turns values of variables into commands replaying the solution,
+// following arcs taken from where traveler starts
+func (n *ilpNetwork) script(values map[string]float64) ([]string, error) {
+	set := func(variable int) bool {
+		return math.Round(values[n.variables[variable].name]) >= 1
+	}
+	amount := func(day map[int]int, date int) int {
+		if v, ok := day[date]; ok {
+			return int(math.Round(values[n.variables[v].name])) * n.step
+		}
+		return 0
+	}
+	commands := []string{}
+	for k, date := n.origin, n.begin; k != n.end; {
+		if date >= n.deadline {
+			return nil, fmt.Errorf("Solution does not reach the ending")
+		}
+		if food, water := amount(n.food[k], date), amount(n.water[k], date); food+water > 0 {
+			commands = append(commands, fmt.Sprintf("buy food:%d water:%d", food, water))
+		}
+		taken := -1
+		for i, a := range n.arcs {
+			if a.from == k && a.date == date && set(a.variable) {
+				taken = i
+				break
+			}
+		}
+		if taken < 0 {
+			return nil, fmt.Errorf("Solution takes no action at '%s' on day %d", n.ids[k], date)
+		}
+		a := n.arcs[taken]
+		if v, ok := n.mine[k][date]; ok && v == a.variable {
+			commands = append(commands, "mine")
+		} else if v, ok := n.stay[k][date]; ok && v == a.variable {
+			commands = append(commands, "stay")
+		} else {
+			commands = append(commands, "go "+n.ids[a.to])
+		}
+		k, date = a.to, a.date+a.days
+	}
+	return commands, nil
+}
+
+func commandILPExport(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	path, step := a.str("file"), a.integer("step")
+	if step <= 0 {
+		return fmt.Errorf("step should be positive")
+	}
+	n, err := t.timeExpanded(step)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".lp":
+		err = n.writeLP(file)
+	case ".mps":
+		err = n.writeMPS(file)
+	default:
+		return fmt.Errorf("Unknown model format '%s', should be .lp or .mps", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Model with %d variables and %d constraints written to: %s\n", len(n.variables), len(n.rows), path)
+	return nil
+}
+
+// exportedNetwork rebuilds the network of a model written by ilp-export, with
+// the step recorded in it, for traveler at the start the model was built from
+func (t *Traveler) exportedNetwork(path string) (*ilpNetwork, error) {
+	comments, err := readComments(path)
+	if err != nil {
+		return nil, err
+	}
+	recorded := map[string]string{}
+	for _, comment := range comments {
+		if i := strings.Index(comment, ": "); i >= 0 {
+			recorded[comment[:i]] = comment[i+2:]
+		}
+	}
+	step, err := strconv.Atoi(recorded["step"])
+	if err != nil {
+		return nil, fmt.Errorf("Model '%s' records no purchase step, export it again", path)
+	}
+	if date := fmt.Sprint(t.date); recorded["start node"] != t.position || recorded["start date"] != date {
+		return nil, fmt.Errorf(
+			"Model '%s' starts at '%s' on day %s, traveler is at '%s' on day %s",
+			path, recorded["start node"], recorded["start date"], t.position, date,
+		)
+	}
+	return t.timeExpanded(step)
+}
+
+func commandILPImport(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	n, err := t.exportedNetwork(a.str("model"))
+	if err != nil {
+		return err
+	}
+	values, err := n.readSolution(a.str("solution"))
+	if err != nil {
+		return err
+	}
+	commands, err := n.script(values)
+	if err != nil {
+		return err
+	}
+	if !a.has("script") {
+		fmt.Println(strings.Join(commands, "\n"))
+		return nil
+	}
+	err = writeScript(a.str("script"), commands)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Command script written to:", a.str("script"))
+	return nil
+}
+
+func writeScript(path string, commands []string) error {
+	return ioutil.WriteFile(path, []byte(strings.Join(commands, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestZeroWeightPathsSameDay walks stage4, where mines and villages are joined
+// by paths of zero weight, which take no day in the time expanded network
+func TestZeroWeightPathsSameDay(t *testing.T) {
+	for position, route := range map[string][]string{"m": {"m'", "e", "f", "ed"}, "v'": {"v", "e", "f", "ed"}} {
+		tr := newTraveler("stage/stage4.txt", SimulationConfig{money: -1, position: position, date: 20, food: 200, water: 200})
+		if tr == nil {
+			t.Fatal("Traveler initialize failed")
+		}
+		tr.weatherList = make([]WeatherType, tr.dayCount)
+		for i := range tr.weatherList {
+			tr.weatherList[i] = []WeatherType{sunny, highTemp}[i%2]
+		}
+		n, err := tr.timeExpanded(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, date := planValues(t, n, position, tr.date, route)
+		commands, err := n.script(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{}
+		for _, id := range route {
+			want = append(want, "go "+id)
+		}
+		if !reflect.DeepEqual(commands, want) {
+			t.Fatalf("Script of the plan is %v, want %v", commands, want)
+		}
+		replay := tr.clone()
+		for _, command := range commands {
+			if err := replay.apply(command); err != nil {
+				t.Fatalf("Replaying '%s': %v", command, err)
+			}
+		}
+		if !replay.finished() || replay.date != date {
+			t.Errorf("Replayed plan ends at %s on day %d, model expects ending on day %d", replay.position, replay.date, date)
+		}
+	}
+}
+
+// planValues sets variables of the plan walking route from position on date,
+// checking the first move takes no day, and returns the day it ends on
+func planValues(t *testing.T, n *ilpNetwork, position string, date int, route []string) (map[string]float64, int) {
+	t.Helper()
+	index := map[string]int{}
+	for k, id := range n.ids {
+		index[id] = k
+	}
+	values := map[string]float64{}
+	k := index[position]
+	values[n.variables[n.at[k][date]].name] = 1
+	for _, id := range route {
+		found := false
+		for _, move := range n.moves {
+			if move.from == k && move.to == index[id] && move.date == date {
+				if id == route[0] && move.days != 0 {
+					t.Fatalf("Walking from %s to %s takes %d days", position, id, move.days)
+				}
+				values[n.variables[move.variable].name] = 1
+				k, date, found = move.to, date+move.days, true
+				values[n.variables[n.at[k][date]].name] = 1
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("No move from %s to %s on day %d", n.ids[k], id, date)
+		}
+	}
+	return values, date
+}
+
+// TestImportedScriptReplays exports a model, imports a solution of it as a
+// script and runs the script with source
+func TestImportedScriptReplays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ilp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model, solution, script := filepath.Join(dir, "desert.lp"), filepath.Join(dir, "desert.sol"), filepath.Join(dir, "plan.txt")
+
+	tr := newTraveler("stage/stage4.txt", SimulationConfig{money: -1, position: "m", date: 20, food: 200, water: 200})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	tr.weatherList = make([]WeatherType, tr.dayCount)
+	for i := range tr.weatherList {
+		tr.weatherList[i] = []WeatherType{sunny, highTemp}[i%2]
+	}
+	states := newRecorder(tr)
+	if err := singleCommand("ilp-export", []string{"ilp-export", model, "step:100"}, tr, states); err != nil {
+		t.Fatal(err)
+	}
+	n, err := tr.timeExpanded(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, date := planValues(t, n, "m", tr.date, []string{"m'", "e", "f", "ed"})
+	lines := []string{}
+	for name, value := range values {
+		lines = append(lines, fmt.Sprintf("%s %g", name, value))
+	}
+	if err := writeScript(solution, lines); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"ilp-import " + model + " " + solution + " " + script, "source " + script} {
+		if err := singleCommand(command, strings.Split(command, " "), tr, states); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !tr.finished() || tr.date != date {
+		t.Errorf("Sourced plan ends at '%s' on day %d, model expects ending on day %d", tr.position, tr.date, date)
+	} else if len(states.commands) != 4 {
+		t.Errorf("History keeps %v, want the 4 commands of script", states.commands)
+	}
+
+	other := newTraveler("stage/stage4.txt", SimulationConfig{money: -1})
+	if err := singleCommand("ilp-import", []string{"ilp-import", model, solution}, other, newRecorder(other)); err == nil {
+		t.Errorf("Model of day 20 is imported for traveler on day 0")
+	}
+}
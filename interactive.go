@@ -1,50 +1,152 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"strconv"
+	"io"
+	"sort"
 	"strings"
 )
 
-var commandMap = map[string]func([]string, *Traveler, *StateRecorder) error{}
+// errQuit is returned by quit to leave the shell
+var errQuit = fmt.Errorf("Quit")
 
 func init() {
-	commandMap["repeat"] = commandRepeat
-	commandMap["undo"] = commandUndo
-	commandMap["redo"] = commandRedo
-	commandMap["undoto"] = commandUndoUntil
-	commandMap["redoto"] = commandRedoUntil
-	commandMap["history"] = commandHistory
-	commandMap["go"] = commandGoto
-	commandMap["log"] = commandLogState
-	commandMap["graph-info"] = commandGraphInfo
-	commandMap["stage-info"] = commandStageInfo
-	commandMap["weather"] = commandWeather
-	commandMap["mine"] = commandMining
-	commandMap["buy"] = commandBuy
-	commandMap["stay"] = commandStay
-	commandMap["random-run"] = randomRun
+	number := func(name string, value string) commandParam {
+		return commandParam{name: name, kind: argInt, value: value}
+	}
+	heuristicNames := []string{}
+	for name := range heuristicMap {
+		heuristicNames = append(heuristicNames, name)
+	}
+	sort.Strings(heuristicNames)
+	heuristics := append([]string{"all"}, heuristicNames...)
+	for _, spec := range []*commandSpec{
+		{name: "help", aliases: []string{"?"}, summary: "List commands or show usage of a command", run: commandHelp,
+			args: []commandParam{{name: "command", optional: true}}},
+		{name: "quit", aliases: []string{"exit"}, summary: "Leave the shell, as does end of input", run: commandQuit},
+		{name: "repeat", summary: "Run a command several times", run: commandRepeat,
+			args: []commandParam{{name: "times", kind: argInt}, {name: "command", variadic: true}}},
+		{name: "while", summary: "Run a command while a condition like food>100 holds", run: commandWhile,
+			args: []commandParam{{name: "condition"}, {name: "command", variadic: true}}},
+		{name: "eval", summary: "Evaluate an expression over traveler, like food/cost(today,food)", run: commandEval,
+			args: []commandParam{{name: "expression", variadic: true}}},
+		{name: "whatif", summary: "Show where actions separated by commas lead, without taking them", run: commandWhatif,
+			args: []commandParam{{name: "command", variadic: true}}},
+		{name: "resolve", summary: "Resolve a day of multiplayer game for players starting as traveler, actions separated by |", run: commandResolve,
+			args: []commandParam{{name: "action", variadic: true}}},
+		{name: "def", summary: "Define a macro from the commands up to end", run: commandDef,
+			args: []commandParam{{name: "name"}}},
+		{name: "end", summary: "Finish definition of a macro", run: commandEnd},
+		{name: "macros", summary: "List defined macros", run: commandMacros},
+		{name: "source", summary: "Run commands of a file line by line, as if typed", run: commandSource,
+			args: []commandParam{{name: "file"}}},
+		{name: "undo", summary: "Go back to the state before last action", run: commandUndo},
+		{name: "redo", summary: "Redo the action undone last", run: commandRedo},
+		{name: "undoto", summary: "Undo actions back to a date", run: commandUndoUntil,
+			args: []commandParam{{name: "date", kind: argInt}}},
+		{name: "redoto", summary: "Redo actions up to a date", run: commandRedoUntil,
+			args: []commandParam{{name: "date", kind: argInt}}},
+		{name: "history", summary: "List actions taken", run: commandHistory},
+		{name: "go", aliases: []string{"goto"}, summary: "Walk to nodes one after another", run: commandGoto, mutating: true,
+			args: []commandParam{{name: "node", kind: argNode, variadic: true}}},
+		{name: "log", summary: "Show state of traveler", run: commandLogState},
+		{name: "graph-info", summary: "Show nodes and edges of graph", run: commandGraphInfo},
+		{name: "stage-info", summary: "Show parameters of stage", run: commandStageInfo},
+		{name: "weather", summary: "List weather of visible days", run: commandWeather},
+		{name: "visibility", summary: "Show weather player can see, set by -visibility on start", run: commandVisibility},
+		{name: "preview", summary: "Show or change what happens when a go command looks fatal", run: commandPreview,
+			args: []commandParam{{name: "mode", choices: []string{"off", "confirm", "strict"}, optional: true}}},
+		{name: "weather-set", summary: "Change weather of a day and replay history", run: commandWeatherSet,
+			args: []commandParam{{name: "day", kind: argInt}, {name: "weather", choices: []string{"sun", "high", "sand"}}}},
+		{name: "weather-resample", summary: "Draw weather from a day on and replay history", run: commandWeatherResample,
+			args:    []commandParam{{name: "day", kind: argInt, optional: true}},
+			options: []commandParam{{name: "seed", kind: argInt}}},
+		{name: "weather-push", summary: "Save weather scenario on stack", run: commandWeatherPush},
+		{name: "weather-pop", summary: "Restore weather scenario saved last", run: commandWeatherPop},
+		{name: "mine", summary: "Mine for a day", run: commandMining, mutating: true},
+		{name: "buy", summary: "Buy resource at village or starting point", run: commandBuy, mutating: true,
+			options: []commandParam{number("food", "0"), number("water", "0")}},
+		{name: "stay", summary: "Stay for a day", run: commandStay, mutating: true},
+		{name: "random-run", summary: "Evaluate random runs or a policy over weather drawn from model", run: randomRun,
+			args: []commandParam{
+				{name: "runs", kind: argInt, value: "30", optional: true},
+				{name: "workers", kind: argInt, value: "0", optional: true},
+				{name: "policy", optional: true},
+			}},
+		{name: "simplify", summary: "Show routes between special nodes, write simplified stage to file", run: commandSimplify,
+			args: []commandParam{{name: "file", optional: true}}},
+		{name: "expand", summary: "List node of each day walking to nodes", run: commandExpand,
+			args: []commandParam{{name: "node", kind: argNode, variadic: true}}},
+		{name: "dominance", summary: "Show dominated nodes and pruned transitions", run: commandDominance},
+		{name: "autoplay", summary: "Play the rest of stage with a policy", run: commandAutoplay,
+			args: []commandParam{{name: "policy"}}},
+		{name: "policies", summary: "List registered policies", run: commandPolicies},
+		{name: "mdp", summary: "Solve stage as Markov decision process", run: commandMDP,
+			options: []commandParam{
+				{name: "survival", kind: argFloat, value: "0.9"},
+				number("unit", "10"), number("bucket", "1000"), number("step", "5"),
+			}},
+		{name: "robust", summary: "Find plan surviving weather with limited sandstorm days", run: commandRobust,
+			options: []commandParam{
+				number("sandstorm", "3"), number("unit", "10"), number("bucket", "1000"),
+				number("step", "5"), number("runs", "1000"),
+			}},
+		{name: "astar", summary: "Search best plan under known weather", run: commandAStar,
+			options: []commandParam{
+				{name: "goal", value: "money", choices: []string{"money", "survival"}},
+				{name: "heuristic", value: "horizon", choices: heuristics},
+				number("step", "10"),
+			}},
+		{name: "ilp-export", summary: "Write time expanded integer program of stage as .lp or .mps", run: commandILPExport,
+			args: []commandParam{{name: "file"}}, options: []commandParam{number("step", "1")}},
+		{name: "ilp-import", summary: "Turn solution of exported program into command script, run it with source", run: commandILPImport,
+			args: []commandParam{{name: "model"}, {name: "solution"}, {name: "script", optional: true}}},
+		{name: "milp", summary: "Solve time expanded integer program with branch and bound, proving optimum only for a few days left, such as stage1 from day 10", run: commandMILP,
+			options: []commandParam{number("nodes", "200"), number("step", "10")}},
+		{name: "sweep", summary: "Run solver over ranges name:from:to[:step] of stage parameters", run: commandSweep,
+			args: []commandParam{{name: "range", variadic: true}},
+			options: []commandParam{
+				{name: "solver", value: "astar"}, number("runs", "200"), number("step", ""), {name: "csv"},
+				{name: "heuristic", value: "horizon", choices: heuristicNames},
+			}},
+		{name: "fit-weather", summary: "Estimate weather model from weather of stages", run: commandFitWeather,
+			args: []commandParam{{name: "file", variadic: true, optional: true}},
+			options: []commandParam{
+				{name: "model", value: "markov", choices: []string{"iid", "markov"}}, {name: "write"},
+			}},
+	} {
+		registerCommand(spec)
+	}
 }
 
 func shell(t *Traveler, states *StateRecorder) {
-	command := ""
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Split(bufio.ScanLines)
-	for command != "quite" {
-		fmt.Print(colorYellow, "Traveling> ", colorNone)
-		scanner.Scan()
-		input := scanner.Text()
+	editor := newLineEditor(*historyFile, shellCompletion(t, states))
+	if editor.terminal {
+		confirm = editor.ask
+	}
+	for {
+		prompt := "Traveling> "
+		if states.defining != "" {
+			prompt = states.defining + "... "
+		}
+		input, err := editor.readLine(colorYellow+prompt+colorNone, len(prompt))
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Println(err)
+			return
+		}
 		commands := strings.Split(input, ";")
 		for _, command := range commands {
 			command = strings.TrimSpace(command)
 			if len(command) == 0 {
 				continue
 			}
-			parts := strings.Split(command, " ")
+			parts := strings.Fields(command)
 			err := singleCommand(command, parts, t, states)
-			if err != nil {
+			if err == errQuit {
+				return
+			} else if err != nil {
 				fmt.Println(err)
 				continue
 			}
@@ -53,32 +155,41 @@ func shell(t *Traveler, states *StateRecorder) {
 }
 
 func singleCommand(command string, parts []string, t *Traveler, states *StateRecorder) error {
-	handler, ok := commandMap[parts[0]]
-	if !ok {
-		return fmt.Errorf("Unknown command `%s`", parts[0])
+	if states.defining != "" && parts[0] != "end" {
+		return defineCommand(command, parts, states)
+	} else if _, ok := states.macros[parts[0]]; ok {
+		return runMacro(parts[0], parts[1:], t, states)
+	}
+	spec, err := findCommand(parts[0])
+	if err != nil {
+		return err
+	}
+	args, err := spec.parse(parts[1:], t)
+	if err != nil {
+		return err
 	}
 	fmt.Println()
-	err := handler(parts[1:], t, states)
+	recorded := states.currPos
+	err = spec.run(args, t, states)
 	if err != nil {
 		return err
 	}
-	if parts[0] != "repeat" {
+	// only actions adding a state are kept, so that commands match states
+	if spec.mutating && states.currPos > recorded {
 		states.appendCommand(command)
 	}
 	fmt.Println()
 	return nil
 }
 
-func commandRepeat(args []string, t *Traveler, states *StateRecorder) error {
-	if len(args) < 2 {
-		return fmt.Errorf("Not enough argument")
-	}
-	times, err := strconv.Atoi(args[0])
-	if err != nil {
-		return err
-	}
-	for i := 0; i < times; i++ {
-		err = singleCommand(strings.Join(args[1:], ""), args[1:], t, states)
+func commandQuit(_ *commandArgs, _ *Traveler, _ *StateRecorder) error {
+	return errQuit
+}
+
+func commandRepeat(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	command := a.list("command")
+	for i := 0; i < a.integer("times"); i++ {
+		err := singleCommand(strings.Join(command, " "), command, t, states)
 		if err != nil {
 			return err
 		}
@@ -86,82 +197,65 @@ func commandRepeat(args []string, t *Traveler, states *StateRecorder) error {
 	return nil
 }
 
-func commandGoto(args []string, t *Traveler, states *StateRecorder) error {
+func commandGoto(a *commandArgs, t *Traveler, states *StateRecorder) error {
 	if !t.ok {
 		return fmt.Errorf("Traveler not in normal state")
+	} else if err := checkMove(t, a.list("node")); err != nil {
+		return err
 	}
-	if len(args) == 0 {
-		return fmt.Errorf("Not enough argument for command")
-	}
-	for _, arg := range args {
-		ok := t.moveTo(arg)
-		if !ok {
-			return fmt.Errorf("No such node with id '%s'", arg)
+	for _, id := range a.list("node") {
+		err := t.moveTo(id)
+		if _, late := err.(*deadlineExceeded); late {
+			// days walked are kept, traveler ends up on the way
+			fmt.Println(err)
+			break
+		} else if err != nil {
+			return err
 		}
 	}
 	t.checkState()
 	states.appendRecord(t)
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandUndo(args []string, t *Traveler, states *StateRecorder) error {
-	if len(args) != 0 {
-		return fmt.Errorf("Too much argument")
-	}
+func commandUndo(a *commandArgs, t *Traveler, states *StateRecorder) error {
 	err := states.undo(t)
 	if err != nil {
 		return err
 	}
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandRedo(args []string, t *Traveler, states *StateRecorder) error {
-	if len(args) != 0 {
-		return fmt.Errorf("Too much argument for command 'back'")
-	}
+func commandRedo(a *commandArgs, t *Traveler, states *StateRecorder) error {
 	err := states.redo(t)
 	if err != nil {
 		return err
 	}
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandUndoUntil(args []string, t *Traveler, states *StateRecorder) error {
-	if len(args) != 1 {
-		return fmt.Errorf("Wrong number of argument")
-	}
-	date, err := strconv.Atoi(args[0])
-	if err != nil {
-		return err
-	}
-	err = states.undoToDate(t, date)
+func commandUndoUntil(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	err := states.undoToDate(t, a.integer("date"))
 	if err != nil {
 		return err
 	}
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandRedoUntil(args []string, t *Traveler, states *StateRecorder) error {
-	if len(args) != 1 {
-		return fmt.Errorf("Wrong number of argument")
-	}
-	date, err := strconv.Atoi(args[0])
+func commandRedoUntil(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	err := states.redoToDate(t, a.integer("date"))
 	if err != nil {
 		return err
 	}
-	err = states.redoToDate(t, date)
-	if err != nil {
-		return err
-	}
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandLogState(_ []string, t *Traveler, _ *StateRecorder) error {
+func commandLogState(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
 	if t == nil {
 		return fmt.Errorf("Invalide traveler")
 	}
@@ -169,63 +263,42 @@ func commandLogState(_ []string, t *Traveler, _ *StateRecorder) error {
 	return nil
 }
 
-func commandHistory(args []string, t *Traveler, states *StateRecorder) error {
+func commandHistory(_ *commandArgs, t *Traveler, states *StateRecorder) error {
 	for i, command := range states.commands[:states.currPos] {
 		fmt.Printf("%d: %s\n", i+1, command)
 	}
 	return nil
 }
 
-func commandMining(args []string, t *Traveler, states *StateRecorder) error {
+func commandMining(a *commandArgs, t *Traveler, states *StateRecorder) error {
 	if !t.ok {
 		return fmt.Errorf("Traveler not in normal state")
 	}
-	ok := t.mining()
-	if !ok {
-		return fmt.Errorf("You have to go to mine to do this")
+	err := t.mining()
+	if err != nil {
+		return err
 	}
 	t.checkState()
 	states.appendRecord(t)
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandBuy(args []string, t *Traveler, states *StateRecorder) error {
+func commandBuy(a *commandArgs, t *Traveler, states *StateRecorder) error {
 	if !t.ok {
 		return fmt.Errorf("Traveler not in normal state")
-	} else if len(args) > 2 {
-		return fmt.Errorf("too much arguments")
 	}
-	var (
-		foodAmount  int
-		waterAmount int
-	)
-	for _, arg := range args {
-		parts := strings.Split(arg, ":")
-		if len(parts) != 2 {
-			return fmt.Errorf("Wrong sperator usage in argument '%s'", arg)
-		}
-		value, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return err
-		}
-		if parts[0] == "food" {
-			foodAmount = value
-		} else if parts[0] == "water" {
-			waterAmount = value
-		}
-	}
-	ok := t.buyResource(foodAmount, waterAmount)
+	ok := t.buyResource(a.integer("food"), a.integer("water"))
 	if !ok {
 		return fmt.Errorf("You have to go to village to do this or buy resource for the first time at starting point")
 	}
 	t.checkState()
 	states.appendRecord(t)
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
 
-func commandGraphInfo(_ []string, t *Traveler, _ *StateRecorder) error {
+func commandGraphInfo(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
 	if t == nil || t.Graph == nil {
 		return fmt.Errorf("Invalid traveler")
 	}
@@ -233,7 +306,7 @@ func commandGraphInfo(_ []string, t *Traveler, _ *StateRecorder) error {
 	return nil
 }
 
-func commandStageInfo(_ []string, t *Traveler, _ *StateRecorder) error {
+func commandStageInfo(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
 	if t == nil || t.Stage == nil {
 		return fmt.Errorf("Invalid traveler")
 	}
@@ -241,20 +314,39 @@ func commandStageInfo(_ []string, t *Traveler, _ *StateRecorder) error {
 	return nil
 }
 
-func commandWeather(_ []string, t *Traveler, _ *StateRecorder) error {
+func commandWeather(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
 	if t == nil || t.Stage == nil {
 		return fmt.Errorf("Invalid traveler")
 	}
-	for i, weather := range t.Stage.weatherList {
+	for i := range t.Stage.weatherList {
+		weather, ok := t.observedWeather(i)
+		if !ok {
+			fmt.Printf("Weather from day %d on is hidden with visibility %s\n", i, t.config.visibility)
+			break
+		}
 		fmt.Printf("%d: %s\n", i, weather)
 	}
 	return nil
 }
 
-func commandStay(args []string, t *Traveler, states *StateRecorder) error {
-	t.stay()
-	t.checkState()
+// commandVisibility only shows visibility, changing it mid-game would reveal
+// weather player was meant not to see
+func commandVisibility(_ *commandArgs, t *Traveler, _ *StateRecorder) error {
+	fmt.Println("Weather visibility:", t.config.visibility)
+	return nil
+}
+
+func commandStay(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	err := t.stay()
+	if _, late := err.(*deadlineExceeded); late {
+		// traveler out of days is kept in error state, as go does
+		fmt.Println(err)
+	} else if err != nil {
+		return err
+	} else {
+		t.checkState()
+	}
 	states.appendRecord(t)
-	commandLogState(args, t, states)
+	commandLogState(a, t, states)
 	return nil
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// historyLimit is number of input lines kept between sessions
+const historyLimit = 1000
+
+// lineEditor reads input lines with emacs style editing, history and tab
+// completion when stdin is a terminal, and plain lines otherwise
+type lineEditor struct {
+	in       *bufio.Reader
+	terminal bool
+	history  []string
+	path     string // file keeping history between sessions, empty for none
+	// complete lists candidates of the word after line, which are filtered by
+	// the part of word typed
+	complete func(line string) []string
+}
+
+func newLineEditor(path string, complete func(string) []string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), path: path, complete: complete}
+	if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+		restore()
+		e.terminal = true
+		e.loadHistory()
+	}
+	return e
+}
+
+func (e *lineEditor) loadHistory() {
+	if e.path == "" {
+		return
+	}
+	file, err := os.Open(e.path)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	file.Close()
+	if len(e.history) <= historyLimit {
+		return
+	}
+	// file is cut down once it grows too long
+	e.history = e.history[len(e.history)-historyLimit:]
+	if file, err := os.Create(e.path); err == nil {
+		fmt.Fprintln(file, strings.Join(e.history, "\n"))
+		file.Close()
+	}
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.path == "" {
+		return
+	}
+	file, err := os.OpenFile(e.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(file, line)
+	file.Close()
+}
+
+// readLine reads a line after printing prompt, width is the number of columns
+// prompt takes without color codes. io.EOF is returned at the end of input.
+func (e *lineEditor) readLine(prompt string, width int) (string, error) {
+	if !e.terminal {
+		fmt.Print(prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	line, err := e.edit(prompt, width)
+	if err == nil {
+		e.addHistory(line)
+	}
+	return line, err
+}
+
+// ask reads answer to a yes or no question, which is not kept in history
+func (e *lineEditor) ask(question string) bool {
+	line, err := e.edit(question, len(question))
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return err == nil && (answer == "y" || answer == "yes")
+}
+
+// edit reads a line from terminal with editing keys
+func (e *lineEditor) edit(prompt string, width int) (string, error) {
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	buf, pos := []rune{}, 0
+	browsing, pending := len(e.history), ""
+	redraw := func() {
+		fmt.Printf("\r%s%s\033[K\r", prompt, string(buf))
+		if width+pos > 0 {
+			fmt.Printf("\033[%dC", width+pos)
+		}
+	}
+	recall := func(i int) {
+		if i < 0 || i > len(e.history) {
+			return
+		}
+		if browsing == len(e.history) {
+			pending = string(buf)
+		}
+		browsing = i
+		if i == len(e.history) {
+			buf = []rune(pending)
+		} else {
+			buf = []rune(e.history[i])
+		}
+		pos = len(buf)
+	}
+	fmt.Print(prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Println()
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Println()
+			return string(buf), nil
+		case 3: // ctrl-c drops the line
+			fmt.Println("^C")
+			return "", nil
+		case 4: // ctrl-d ends input on an empty line
+			if len(buf) == 0 {
+				fmt.Println()
+				return "", io.EOF
+			} else if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1:
+			pos = 0
+		case 5:
+			pos = len(buf)
+		case 2:
+			if pos > 0 {
+				pos--
+			}
+		case 6:
+			if pos < len(buf) {
+				pos++
+			}
+		case 11:
+			buf = buf[:pos]
+		case 21:
+			buf, pos = buf[pos:], 0
+		case 23:
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf, pos = append(buf[:start], buf[pos:]...), start
+		case 12:
+			fmt.Print("\033[H\033[2J")
+		case 16:
+			recall(browsing - 1)
+		case 14:
+			recall(browsing + 1)
+		case '\t':
+			buf, pos = e.completeWord(buf, pos, prompt)
+		case 27:
+			switch e.escape() {
+			case 'A':
+				recall(browsing - 1)
+			case 'B':
+				recall(browsing + 1)
+			case 'C':
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '~':
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+		}
+		redraw()
+	}
+}
+
+// escape reads the rest of an escape sequence of a key, returning the final
+// letter of arrows, H for home, F for end and ~ for delete
+func (e *lineEditor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	param := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		} else if r < '0' || r > '9' {
+			break
+		}
+		param += string(r)
+	}
+	if r != '~' {
+		return r
+	}
+	switch param {
+	case "1", "7":
+		return 'H'
+	case "4", "8":
+		return 'F'
+	case "3":
+		return '~'
+	}
+	return 0
+}
+
+// completeWord completes the word before cursor, listing the candidates if
+// they have nothing more in common
+func (e *lineEditor) completeWord(buf []rune, pos int, prompt string) ([]rune, int) {
+	start := pos
+	for start > 0 && buf[start-1] != ' ' && buf[start-1] != ';' {
+		start--
+	}
+	word := string(buf[start:pos])
+	candidates := []string{}
+	for _, candidate := range e.complete(string(buf[:start])) {
+		if strings.HasPrefix(candidate, word) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Strings(candidates)
+	if len(candidates) == 0 {
+		fmt.Print("\a")
+		return buf, pos
+	}
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	// options end with a colon and take their value right after it
+	if len(candidates) == 1 && !strings.HasSuffix(common, ":") {
+		common += " "
+	}
+	if len(common) == len(word) {
+		fmt.Printf("\n%s\n%s", strings.Join(candidates, "  "), prompt)
+		return buf, pos
+	}
+	insert := []rune(common[len(word):])
+	buf = append(buf[:pos], append(insert, buf[pos:]...)...)
+	return buf, pos + len(insert)
+}
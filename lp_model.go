@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type lpKind int
+
+const (
+	lpContinuous lpKind = iota
+	lpInteger
+	lpBinary
+)
+
+type lpVariable struct {
+	name  string
+	kind  lpKind
+	lower float64
+	upper float64 // math.Inf(1) for no upper bound
+	// priority orders branching in branch and bound, lower value first
+	priority int
+}
+
+type lpTerm struct {
+	index int
+	coef  float64
+}
+
+type lpRow struct {
+	name  string
+	terms []lpTerm
+	sense string // one of "<=", ">=" and "="
+	rhs   float64
+}
+
+// lpModel is a mixed integer linear program maximizing objective
+type lpModel struct {
+	name      string
+	variables []lpVariable
+	index     map[string]int
+	rows      []lpRow
+	objective []lpTerm
+	comments  []string
+	// objective of integral solutions differ by multiples of granularity
+	granularity float64
+}
+
+func newLPModel(name string) *lpModel {
+	return &lpModel{name: name, index: map[string]int{}, granularity: 1}
+}
+
+func (m *lpModel) variable(name string, kind lpKind, lower float64, upper float64) int {
+	if kind == lpBinary {
+		lower, upper = math.Max(lower, 0), math.Min(upper, 1)
+	}
+	m.index[name] = len(m.variables)
+	m.variables = append(m.variables, lpVariable{name: name, kind: kind, lower: lower, upper: upper})
+	return len(m.variables) - 1
+}
+
+func (m *lpModel) constrain(name string, terms []lpTerm, sense string, rhs float64) {
+	m.rows = append(m.rows, lpRow{name: name, terms: terms, sense: sense, rhs: rhs})
+}
+
+func formatNumber(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// writeLP writes model in CPLEX LP format
+func (m *lpModel) writeLP(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "\\ %s\n", m.name)
+	for _, comment := range m.comments {
+		fmt.Fprintf(buf, "\\ %s\n", comment)
+	}
+	fmt.Fprint(buf, "Maximize\n obj:")
+	m.writeTerms(buf, m.objective)
+	fmt.Fprint(buf, "\nSubject To\n")
+	for _, row := range m.rows {
+		fmt.Fprintf(buf, " %s:", row.name)
+		m.writeTerms(buf, row.terms)
+		fmt.Fprintf(buf, " %s %s\n", row.sense, formatNumber(row.rhs))
+	}
+	fmt.Fprint(buf, "Bounds\n")
+	for _, v := range m.variables {
+		if v.kind == lpBinary && v.lower == 0 && v.upper == 1 {
+			continue
+		} else if v.lower == v.upper {
+			fmt.Fprintf(buf, " %s = %s\n", v.name, formatNumber(v.lower))
+		} else if math.IsInf(v.upper, 1) {
+			if v.lower != 0 {
+				fmt.Fprintf(buf, " %s >= %s\n", v.name, formatNumber(v.lower))
+			}
+		} else {
+			fmt.Fprintf(buf, " %s <= %s <= %s\n", formatNumber(v.lower), v.name, formatNumber(v.upper))
+		}
+	}
+	for _, section := range []struct {
+		title string
+		kind  lpKind
+	}{{"General", lpInteger}, {"Binary", lpBinary}} {
+		names := []string{}
+		for _, v := range m.variables {
+			if v.kind == section.kind {
+				names = append(names, v.name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		fmt.Fprintln(buf, section.title)
+		for i := 0; i < len(names); i += 8 {
+			end := i + 8
+			if end > len(names) {
+				end = len(names)
+			}
+			fmt.Fprintf(buf, " %s\n", strings.Join(names[i:end], " "))
+		}
+	}
+	fmt.Fprint(buf, "End\n")
+	return buf.Flush()
+}
+
+// writeTerms keeps lines of LP file short as some readers limit their length
+func (m *lpModel) writeTerms(w io.Writer, terms []lpTerm) {
+	if len(terms) == 0 {
+		fmt.Fprint(w, " 0 "+m.variables[0].name)
+	}
+	for i, term := range terms {
+		if i > 0 && i%8 == 0 {
+			fmt.Fprint(w, "\n   ")
+		}
+		sign := "+"
+		if term.coef < 0 {
+			sign = "-"
+		}
+		fmt.Fprintf(w, " %s %s %s", sign, formatNumber(math.Abs(term.coef)), m.variables[term.index].name)
+	}
+}
+
+// writeMPS writes model in free MPS format, as names are longer than fixed
+// format allows. Objective is negated to be minimized as MPS readers do by
+// default.
+func (m *lpModel) writeMPS(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, comment := range m.comments {
+		fmt.Fprintf(buf, "* %s\n", comment)
+	}
+	fmt.Fprint(buf, "* free MPS format, like glpsol --freemps reads\n")
+	fmt.Fprint(buf, "* objective is negated, minimize it\n")
+	fmt.Fprintf(buf, "NAME          %s\n", m.name)
+	fmt.Fprint(buf, "ROWS\n N  obj\n")
+	senses := map[string]string{"<=": "L", ">=": "G", "=": "E"}
+	for _, row := range m.rows {
+		fmt.Fprintf(buf, " %s  %s\n", senses[row.sense], row.name)
+	}
+	columns := make([][]struct {
+		row  string
+		coef float64
+	}, len(m.variables))
+	add := func(row string, terms []lpTerm, sign float64) {
+		for _, term := range terms {
+			columns[term.index] = append(columns[term.index], struct {
+				row  string
+				coef float64
+			}{row, sign * term.coef})
+		}
+	}
+	add("obj", m.objective, -1)
+	for _, row := range m.rows {
+		add(row.name, row.terms, 1)
+	}
+	fmt.Fprint(buf, "COLUMNS\n")
+	integer := false
+	for i, v := range m.variables {
+		if (v.kind != lpContinuous) != integer {
+			integer = !integer
+			marker := "INTEND"
+			if integer {
+				marker = "INTORG"
+			}
+			fmt.Fprintf(buf, "    MARKER                 'MARKER'                 '%s'\n", marker)
+		}
+		if len(columns[i]) == 0 {
+			fmt.Fprintf(buf, "    %-8s  %-8s  %12s\n", v.name, "obj", "0")
+		}
+		for _, entry := range columns[i] {
+			fmt.Fprintf(buf, "    %-8s  %-8s  %12s\n", v.name, entry.row, formatNumber(entry.coef))
+		}
+	}
+	if integer {
+		fmt.Fprint(buf, "    MARKER                 'MARKER'                 'INTEND'\n")
+	}
+	fmt.Fprint(buf, "RHS\n")
+	for _, row := range m.rows {
+		if row.rhs != 0 {
+			fmt.Fprintf(buf, "    RHS       %-8s  %12s\n", row.name, formatNumber(row.rhs))
+		}
+	}
+	fmt.Fprint(buf, "BOUNDS\n")
+	for _, v := range m.variables {
+		switch {
+		case v.kind == lpBinary && v.lower == 0 && v.upper == 1:
+			fmt.Fprintf(buf, " BV BND       %s\n", v.name)
+		case v.lower == v.upper:
+			fmt.Fprintf(buf, " FX BND       %-8s  %12s\n", v.name, formatNumber(v.lower))
+		default:
+			if v.lower != 0 {
+				fmt.Fprintf(buf, " LO BND       %-8s  %12s\n", v.name, formatNumber(v.lower))
+			}
+			if math.IsInf(v.upper, 1) && v.kind != lpContinuous {
+				fmt.Fprintf(buf, " PL BND       %s\n", v.name)
+			} else if !math.IsInf(v.upper, 1) {
+				fmt.Fprintf(buf, " UP BND       %-8s  %12s\n", v.name, formatNumber(v.upper))
+			}
+		}
+	}
+	fmt.Fprint(buf, "ENDATA\n")
+	return buf.Flush()
+}
+
+// readComments reads comments heading a model written as .lp or .mps
+func readComments(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	comments := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "\\ ") && !strings.HasPrefix(line, "* ") {
+			break
+		}
+		comments = append(comments, line[2:])
+	}
+	return comments, scanner.Err()
+}
+
+// readSolution reads values of model's variables from a solver's solution
+// file
+func (m *lpModel) readSolution(path string) (map[string]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values, err := m.parseSolution(file)
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("No value of model variables found in '%s'", path)
+	}
+	return values, err
+}
+
+// parseSolution reads solution of glpsol --output, CBC, Gurobi, HiGHS or SCIP.
+// Each of them lists a variable name followed by its value, glpsol puts a *
+// before values of integer columns and the value on the next line when the
+// name is long.
+func (m *lpModel) parseSolution(r io.Reader) (map[string]float64, error) {
+	values := map[string]float64{}
+	pending := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if pending != "" {
+			fields = append([]string{pending}, fields...)
+			pending = ""
+		}
+		for i := 0; i < len(fields); i++ {
+			if _, ok := m.index[fields[i]]; !ok {
+				continue
+			}
+			j := i + 1
+			if j < len(fields) && fields[j] == "*" {
+				j++
+			}
+			if j == len(fields) {
+				pending = fields[i]
+			} else if value, err := strconv.ParseFloat(fields[j], 64); err == nil {
+				values[fields[i]] = value
+			}
+			break
+		}
+	}
+	return values, scanner.Err()
+}
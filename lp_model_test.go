@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseSolution(t *testing.T) {
+	m := newLPModel("test")
+	m.variable("x_0_0", lpBinary, 0, 1)
+	m.variable("bf_1_2", lpInteger, 0, 600)
+	m.variable("ws_12_10_1100", lpContinuous, 0, 400)
+	m.constrain("finish", []lpTerm{{0, 1}}, "=", 1)
+	want := map[string]float64{"x_0_0": 1, "bf_1_2": 40, "ws_12_10_1100": 12.5}
+	solutions := map[string]string{
+		"glpsol": `Problem:    test
+Status:     INTEGER OPTIMAL
+
+   No.   Row name        Activity     Lower bound   Upper bound
+------ ------------    ------------- ------------- -------------
+     1 finish                      1             1             =
+
+   No. Column name       Activity     Lower bound   Upper bound
+------ ------------    ------------- ------------- -------------
+     1 x_0_0        *              1             0             1
+     2 bf_1_2       *             40             0           600
+     3 ws_12_10_1100
+                                12.5             0           400
+`,
+		"cbc": `Optimal - objective value -10470.00000000
+      0 x_0_0                        1                       0
+      1 bf_1_2                      40                       0
+      2 ws_12_10_1100             12.5                       0
+`,
+		"gurobi": `# Objective value = -10470
+x_0_0 1
+bf_1_2 40
+ws_12_10_1100 12.5
+`,
+		"highs": `Model status
+Optimal
+
+# Primal solution values
+Feasible
+Objective -10470
+# Columns 3
+x_0_0 1
+bf_1_2 40
+ws_12_10_1100 12.5
+# Rows 1
+finish 1
+`,
+		"scip": `solution status: optimal solution found
+objective value:                               -10470
+x_0_0                                               1 	(obj:0)
+bf_1_2                                             40 	(obj:0)
+ws_12_10_1100                                    12.5 	(obj:0)
+`,
+	}
+	for solver, text := range solutions {
+		values, err := m.parseSolution(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("%s: %v", solver, err)
+		}
+		for name, value := range want {
+			if got, ok := values[name]; !ok || got != value {
+				t.Errorf("%s: %s is %v (found %v), want %v", solver, name, got, ok, value)
+			}
+		}
+	}
+}
+
+func TestExportIsDeterministic(t *testing.T) {
+	tr := testTraveler(t, "stage/stage1.txt")
+	var first []byte
+	for i := 0; i < 5; i++ {
+		n, err := tr.timeExpanded(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		if err := n.writeMPS(buf); err != nil {
+			t.Fatal(err)
+		} else if err := n.writeLP(buf); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(first, buf.Bytes()) {
+			t.Fatal("exported model differs between runs")
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// macroDepth limits macros and scripts running each other, so that a
+// recursive one stops
+const macroDepth = 64
+
+// commandWhile runs a command as long as condition, an expression written
+// without spaces, holds. It stops as well once traveler is not in normal
+// state, on Ctrl-C, or when the command leaves traveler unchanged, which
+// would loop forever.
+func commandWhile(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	condition, err := parseExpression(a.str("condition"))
+	if err != nil {
+		return err
+	}
+	holds := func(t *Traveler) (bool, error) {
+		value, err := condition.eval(t)
+		return value != 0, err
+	}
+	command := strings.Join(a.list("command"), " ")
+	ctx, cancel := interruptContext()
+	defer cancel()
+	for t.ok {
+		if ok, err := holds(t); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		} else if ctx.Err() != nil {
+			return fmt.Errorf("Interrupted")
+		}
+		before := t.Snapshot()
+		if err := singleCommand(command, a.list("command"), t, states); err != nil {
+			return err
+		}
+		if t.Snapshot() == before {
+			return fmt.Errorf("`%s` leaves traveler unchanged, stopped", command)
+		}
+	}
+	return nil
+}
+
+// commandDef starts definition of a macro, commands up to end make its body
+func commandDef(a *commandArgs, _ *Traveler, states *StateRecorder) error {
+	name := a.str("name")
+	if _, err := findCommand(name); err == nil {
+		return fmt.Errorf("`%s` is a command and cannot be a macro", name)
+	}
+	states.defining = name
+	states.macros[name] = []string{}
+	fmt.Printf("Defining macro `%s`, finish with end\n", name)
+	return nil
+}
+
+func commandEnd(_ *commandArgs, _ *Traveler, states *StateRecorder) error {
+	if states.defining == "" {
+		return fmt.Errorf("No macro is being defined")
+	}
+	fmt.Printf("Macro `%s` defined with %d commands\n", states.defining, len(states.macros[states.defining]))
+	states.defining = ""
+	return nil
+}
+
+func commandMacros(_ *commandArgs, _ *Traveler, states *StateRecorder) error {
+	names := []string{}
+	for name := range states.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %s\n", name, strings.Join(states.macros[name], "; "))
+	}
+	return nil
+}
+
+// defineCommand adds a command to the body of macro being defined
+func defineCommand(command string, parts []string, states *StateRecorder) error {
+	if parts[0] == "def" {
+		return fmt.Errorf("Macros cannot be defined inside macro `%s`", states.defining)
+	}
+	states.macros[states.defining] = append(states.macros[states.defining], command)
+	return nil
+}
+
+// runMacro runs commands of macro, each is kept in history as it would be
+// when typed
+func runMacro(name string, args []string, t *Traveler, states *StateRecorder) error {
+	if len(args) != 0 {
+		return fmt.Errorf("Macro `%s` takes no argument", name)
+	} else if states.depth >= macroDepth {
+		return fmt.Errorf("Macros nest deeper than %d, stopped at `%s`", macroDepth, name)
+	}
+	states.depth++
+	defer func() { states.depth-- }()
+	for _, command := range states.macros[name] {
+		parts := strings.Fields(command)
+		err := singleCommand(command, parts, t, states)
+		if _, nested := states.macros[parts[0]]; err != nil && !nested {
+			return fmt.Errorf("Macro `%s` stopped at '%s': %v", name, command, err)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandSource runs commands of a file, like scripts written by ilp-import,
+// as lines typed in the shell. Lines starting with # are comments. It stops
+// at the first failing command.
+func commandSource(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	path := a.str("file")
+	if states.depth >= macroDepth {
+		return fmt.Errorf("Scripts nest deeper than %d, stopped at '%s'", macroDepth, path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	states.depth++
+	defer func() { states.depth-- }()
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, command := range strings.Split(line, ";") {
+			command = strings.TrimSpace(command)
+			if len(command) == 0 {
+				continue
+			}
+			err := singleCommand(command, strings.Fields(command), t, states)
+			if err == errQuit {
+				return err
+			} else if err != nil {
+				return fmt.Errorf("%s:%d: '%s': %v", path, i+1, command, err)
+			}
+		}
+	}
+	return nil
+}
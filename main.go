@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 const (
@@ -20,27 +23,64 @@ var initWater = flag.Int("water", 0, "Initial water for travler")
 var initFood = flag.Int("food", 0, "Initial food for travler")
 var notFirstBuy = flag.Bool("first", false, "Initial state of first state")
 var isInverse = flag.Bool("inverse", false, "Inverse traveling process, cumulate resource from current place")
+var prune = flag.Bool("prune", false, "Let solvers skip moves to dominated nodes")
+var visibility = flag.String("visibility", "full", "Weather player can see: full, today or none")
+var preview = flag.String("preview", "confirm", "Preview of go commands: off, confirm or strict")
+var historyFile = flag.String("history", defaultHistoryFile(), "File keeping shell input between sessions, empty for none")
+var serveAddr = flag.String("serve", "", "Serve sessions as HTTP JSON on address like :8080 instead of running shell")
+var hostAddr = flag.String("host", "", "Host a multiplayer game over WebSocket on address like :8090")
+var gamePlayers = flag.Int("players", 2, "Number of players a hosted game waits for")
+var idleTimeout = flag.Duration("idle", time.Minute, "Time players have to act each day before they stay")
+var joinAddr = flag.String("join", "", "Join a multiplayer game at address like ws://localhost:8090/play")
+var playerName = flag.String("name", "", "Player name shown to others in a joined game")
 
 func main() {
 	flag.Parse()
-	t := newTraveler(*stageFile)
+	if _, ok := visibilityMap[*visibility]; !ok {
+		log.Println("Unknown visibility", *visibility)
+		return
+	} else if _, ok := previewMap[*preview]; !ok {
+		log.Println("Unknown preview mode", *preview)
+		return
+	}
+	if *serveAddr != "" {
+		log.Fatal(serve(*serveAddr, *stageFile))
+	} else if *hostAddr != "" {
+		log.Fatal(hostGame(*hostAddr, *stageFile, *gamePlayers, *idleTimeout))
+	} else if *joinAddr != "" {
+		if err := playGame(*joinAddr, *playerName); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	t := newTraveler(*stageFile, configFromFlags())
 	if t == nil {
 		log.Println("Traveler initialize failed")
 		return
 	}
-	travelerInit(t)
 	states := newRecorder(t)
 	shell(t, states)
 }
 
-func travelerInit(t *Traveler) {
-	t.date = *initDate
-	t.position = *initPosition
-	if *initMoney >= 0 {
-		t.money = *initMoney
+func configFromFlags() SimulationConfig {
+	return SimulationConfig{
+		inverse:    *isInverse,
+		position:   *initPosition,
+		date:       *initDate,
+		money:      *initMoney,
+		food:       *initFood,
+		water:      *initWater,
+		firstBuy:   !*notFirstBuy,
+		prune:      *prune,
+		visibility: visibilityMap[*visibility],
+		preview:    previewMap[*preview],
+	}
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
 	}
-	t.food = *initFood
-	t.water = *initWater
-	t.loadSpace = t.loadSpace - t.food*t.resourceWeight[resourceFood] + t.water*t.resourceWeight[resourceWater]
-	t.firstBuy = !*notFirstBuy
+	return filepath.Join(home, ".modling_history")
 }
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// mdpState is a state of game MDP. Food and water are counted in units of
+// boxes, money is rounded down to bucket. Nodes are indexes into solver's node
+// list, state with remaining > 0 is on the way to target. Fields are kept small
+// since solver may hold millions of them.
+type mdpState struct {
+	date      int16
+	node      int16
+	target    int16
+	remaining int16
+	food      int32
+	water     int32
+	money     int32
+	storms    int16       // sandstorm days so far, only counted in robust mode
+	weather   WeatherType // weather of today, known when deciding
+	arrived   bool        // traveler arrived at node today
+	first     bool        // next purchase is the first one
+	shopped   bool        // purchase of today is already decided
+}
+
+const (
+	actionNone int16 = -1 - iota
+	actionStay
+	actionMine
+	actionBuy
+)
+
+type mdpValue struct {
+	value    float64 // expected money gained from this state on
+	survival float64
+	action   int16 // best action of today, non-negative value means moving to that node
+	buyFood  int16 // units of food bought by best purchase
+	buyWater int16
+	worst    WeatherType // weather chosen by adversary in robust mode
+}
+
+const (
+	outcomeNext    int8 = iota // day passes, tomorrow's weather is unknown yet
+	outcomeSameDay             // no day passes, as moving along zero weight path
+	outcomeFinish
+	outcomeDead
+)
+
+// mdpMove is an action of today and the state it leads to
+type mdpMove struct {
+	action  int16
+	next    mdpState
+	reward  int
+	outcome int8
+}
+
+// mdpSolver computes expectimax policy of game under a weather model. Daily
+// consumption is rounded up to units, so the model never overestimates stock.
+// Dying is valued as losing all money plus penalty, raising penalty trades
+// expected money for survival probability. In robust mode weather is chosen by
+// an adversary allowed at most storms sandstorm days, and dying is never
+// acceptable.
+type mdpSolver struct {
+	*Traveler
+	model    *WeatherModel
+	unit     int
+	bucket   int
+	step     int
+	penalty  float64
+	robust   bool
+	storms   int
+	origin   int // date of first day counted for storms
+	ids      []string
+	index    map[string]int16
+	moves    [][]int16         // move candidates of each node
+	memo     *sync.Map         // mdpState to mdpValue, shared by policy workers
+	visiting map[mdpState]bool // states on the path being solved, own to each decide
+}
+
+func newMDPSolver(t *Traveler, unit int, bucket int, step int, penalty float64) *mdpSolver {
+	m := &mdpSolver{
+		Traveler: t.clone(),
+		model:    t.weather(),
+		unit:     unit,
+		bucket:   bucket,
+		step:     step,
+		penalty:  penalty,
+		ids:      t.sortedIDs(),
+		index:    map[string]int16{},
+		memo:     &sync.Map{},
+		visiting: map[mdpState]bool{},
+	}
+	for i, id := range m.ids {
+		m.index[id] = int16(i)
+	}
+	for _, id := range m.ids {
+		moves := []int16{}
+		for _, idn := range m.moveCandidates(id) {
+			moves = append(moves, m.index[idn])
+		}
+		m.moves = append(m.moves, moves)
+	}
+	return m
+}
+
+func (m *mdpSolver) kind(node int16) NodeType {
+	return m.nodes[m.ids[node]].nodeType
+}
+
+func (m *mdpSolver) floorMoney(money int) int32 {
+	if money < 0 {
+		return int32(money)
+	}
+	return int32(money / m.bucket * m.bucket)
+}
+
+// cost returns units of resource consumed in a day, rounded up
+func (m *mdpSolver) cost(weather WeatherType, kind ResourceType, multiplier int) int32 {
+	boxes := m.resourceBaseCost[weather][kind] * multiplier
+	return int32((boxes + m.unit - 1) / m.unit)
+}
+
+// canBuy reports whether traveler can buy today, node of a state on the way
+// is the one left behind
+func (m *mdpSolver) canBuy(s mdpState) bool {
+	if s.remaining > 0 {
+		return false
+	}
+	kind := m.kind(s.node)
+	return kind == villageNode || (kind == startingNode && s.first)
+}
+
+func (m *mdpSolver) dead(s mdpState) mdpValue {
+	if m.robust {
+		return mdpValue{value: math.Inf(-1), action: actionNone}
+	}
+	return mdpValue{value: -float64(s.money) - m.penalty, action: actionNone}
+}
+
+// observe maps traveler state to MDP state, rounding resource and money down
+func (m *mdpSolver) observe(t *Traveler, weather WeatherType) mdpState {
+	s := mdpState{
+		date:    int16(t.date),
+		node:    m.index[t.position],
+		food:    int32(t.food / m.unit),
+		water:   int32(t.water / m.unit),
+		money:   m.floorMoney(t.money),
+		weather: weather,
+		arrived: t.arrivalDate == t.date,
+		first:   t.firstBuy,
+	}
+	if !m.robust {
+		return s
+	}
+	for date := m.origin; date <= t.date; date++ {
+		past, _ := t.observedWeather(date)
+		if (date < t.date && past == sandStorm) || (date == t.date && weather == sandStorm) {
+			s.storms++
+		}
+	}
+	if int(s.storms) > m.storms {
+		s.storms = int16(m.storms)
+	}
+	return s
+}
+
+// solve returns value of state whose weather of today is known. It is not
+// memorized, as each day is evaluated through expect only once per state.
+func (m *mdpSolver) solve(s mdpState) mdpValue {
+	if !s.shopped && !m.canBuy(s) {
+		s.shopped = true
+	}
+	if m.visiting[s] {
+		return mdpValue{value: math.Inf(-1), action: actionNone}
+	}
+	m.visiting[s] = true
+	v := m.evaluate(s)
+	delete(m.visiting, s)
+	return v
+}
+
+// expect returns value of state averaged over weather of its day, prev is the
+// weather of the day before. For i.i.d. weather model the key forgets prev. In
+// robust mode the worst allowed weather is taken instead of average.
+func (m *mdpSolver) expect(s mdpState, prev WeatherType) mdpValue {
+	key := s
+	key.weather = highTemp
+	if m.model.markov && !m.robust {
+		key.weather = prev
+	}
+	if v, ok := m.memo.Load(key); ok {
+		return v.(mdpValue)
+	}
+	var result mdpValue
+	if m.robust {
+		result = mdpValue{value: math.Inf(1), survival: 1, action: actionNone}
+		for _, weather := range weatherKinds {
+			next := s
+			next.weather = weather
+			if weather == sandStorm {
+				if int(s.storms) >= m.storms {
+					continue
+				}
+				next.storms++
+			}
+			v := m.solve(next)
+			if v.value < result.value {
+				result.value, result.survival, result.worst = v.value, v.survival, weather
+			}
+		}
+	} else {
+		result = mdpValue{action: actionNone}
+		p := m.model.next(prev)
+		for _, weather := range weatherKinds {
+			if p[weather] == 0 {
+				continue
+			}
+			s.weather = weather
+			v := m.solve(s)
+			result.value += p[weather] * v.value
+			result.survival += p[weather] * v.survival
+		}
+	}
+	m.memo.Store(key, result)
+	return result
+}
+
+func (m *mdpSolver) evaluate(s mdpState) mdpValue {
+	if m.ids[s.node] == m.ending.id && s.remaining == 0 {
+		return mdpValue{survival: 1, action: actionNone}
+	} else if int(s.date) >= m.dayCount {
+		return m.dead(s)
+	} else if !s.shopped {
+		return m.shop(s)
+	}
+	best := mdpValue{value: math.Inf(-1), action: actionNone}
+	for _, move := range m.dayMoves(s) {
+		v := m.moveValue(s, move)
+		if v.value > best.value || best.action == actionNone {
+			best = v
+			best.action = move.action
+		}
+	}
+	return best
+}
+
+func (m *mdpSolver) moveValue(s mdpState, move mdpMove) mdpValue {
+	var v mdpValue
+	switch move.outcome {
+	case outcomeDead:
+		return m.dead(s)
+	case outcomeFinish:
+		return mdpValue{value: float64(move.reward), survival: 1}
+	case outcomeSameDay:
+		v = m.solve(move.next)
+	default:
+		v = m.expect(move.next, s.weather)
+	}
+	v.value += float64(move.reward)
+	return v
+}
+
+// dayMoves lists actions possible today, state on the way can only keep going
+func (m *mdpSolver) dayMoves(s mdpState) []mdpMove {
+	if s.remaining > 0 {
+		return []mdpMove{m.walk(s, s.target, int(s.remaining))}
+	}
+	next := s
+	next.arrived, next.shopped = false, false
+	moves := []mdpMove{m.pass(s, actionStay, m.stayCost, 0, next)}
+	if m.kind(s.node) == mineNode && (!s.arrived || m.arrivalMining) {
+		moves = append(moves, m.pass(s, actionMine, m.mineCost, m.baseIncome, next))
+	}
+	for _, node := range m.moves[s.node] {
+		moves = append(moves, m.walk(s, node, m.weight(m.ids[s.node], m.ids[node])))
+	}
+	return moves
+}
+
+// pass consumes resource of today and moves on to next day
+func (m *mdpSolver) pass(s mdpState, action int16, multiplier int, reward int, next mdpState) mdpMove {
+	move := mdpMove{action: action, reward: reward}
+	next.food = s.food - m.cost(s.weather, resourceFood, multiplier)
+	next.water = s.water - m.cost(s.weather, resourceWater, multiplier)
+	next.date = s.date + 1
+	next.money = m.floorMoney(int(s.money) + reward)
+	move.next = next
+	if next.food < 0 || next.water < 0 {
+		move.outcome = outcomeDead
+	} else if next.remaining == 0 && m.ids[next.node] == m.ending.id {
+		move.outcome = outcomeFinish
+	} else if int(next.date) >= m.dayCount {
+		move.outcome = outcomeDead
+	}
+	return move
+}
+
+// walk goes toward target for today, distance is walking days left
+func (m *mdpSolver) walk(s mdpState, target int16, distance int) mdpMove {
+	next := s
+	next.arrived, next.shopped = false, false
+	next.target, next.remaining = target, int16(distance)
+	if distance == 0 {
+		next.node, next.target, next.arrived = target, 0, true
+		return mdpMove{action: target, next: next, outcome: outcomeSameDay}
+	}
+	multiplier := m.walkCost
+	if s.weather == sandStorm && !m.sandMovable {
+		multiplier = m.stayCost
+	} else {
+		next.remaining--
+	}
+	if next.remaining == 0 {
+		next.node, next.target = target, 0
+	}
+	return m.pass(s, target, multiplier, 0, next)
+}
+
+// purchase returns state after buying units of food and water and its price
+func (m *mdpSolver) purchase(s mdpState, food int, water int) (mdpState, int) {
+	price := food*m.unit*m.resourceBasePrice[resourceFood] + water*m.unit*m.resourceBasePrice[resourceWater]
+	if !s.first {
+		price *= 2
+	}
+	s.food += int32(food)
+	s.water += int32(water)
+	s.money = m.floorMoney(int(s.money) - price)
+	s.first = false
+	s.shopped = true
+	return s, price
+}
+
+func (m *mdpSolver) shop(s mdpState) mdpValue {
+	next := s
+	next.shopped = true
+	best := m.solve(next)
+	best.action, best.buyFood, best.buyWater = actionNone, 0, 0
+	weight := func(food int, water int) int {
+		return m.unit * (food*m.resourceWeight[resourceFood] + water*m.resourceWeight[resourceWater])
+	}
+	stock := func(food int, water int) int {
+		return weight(int(s.food)+food, int(s.water)+water)
+	}
+	for food := 0; stock(food, 0) <= m.load; food += m.step {
+		for water := 0; stock(food, water) <= m.load; water += m.step {
+			if food == 0 && water == 0 {
+				continue
+			}
+			next, price := m.purchase(s, food, water)
+			if price > int(s.money) {
+				break
+			}
+			v := m.solve(next)
+			v.value -= float64(price)
+			if v.value > best.value {
+				best = v
+				best.action, best.buyFood, best.buyWater = actionBuy, int16(food), int16(water)
+			}
+		}
+	}
+	return best
+}
+
+// rootValue returns value of traveler's current state, taking expectation or
+// the worst case over today's weather when it is not known
+func (m *mdpSolver) rootValue(t *Traveler) mdpValue {
+	if weather, ok := t.observedWeather(t.date); ok {
+		return m.solve(m.observe(t, weather))
+	} else if m.robust {
+		return m.expect(m.observe(t, highTemp), highTemp)
+	}
+	result := mdpValue{}
+	p := m.model.first()
+	for _, weather := range weatherKinds {
+		v := m.solve(m.observe(t, weather))
+		result.value += p[weather] * v.value
+		result.survival += p[weather] * v.survival
+	}
+	return result
+}
+
+// explored counts states in memo
+func (m *mdpSolver) explored() int {
+	count := 0
+	m.memo.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func (m *mdpSolver) decide(t *Traveler) []string {
+	// the model decides knowing weather of today
+	weather, ok := t.observedWeather(t.date)
+	if !t.alive() || !ok {
+		return nil
+	}
+	// workers of a random run decide at once, each on a copy of solver which
+	// shares memo but tracks its own path
+	w := *m
+	w.visiting = map[mdpState]bool{}
+	m = &w
+	s := m.observe(t, weather)
+	v := m.solve(s)
+	commands := []string{}
+	if !s.shopped && m.canBuy(s) {
+		if v.action == actionBuy {
+			food, water := int(v.buyFood)*m.unit, int(v.buyWater)*m.unit
+			// real stock may exceed its rounded units, keep purchase within load
+			for food*t.resourceWeight[resourceFood]+water*t.resourceWeight[resourceWater] > t.loadSpace {
+				if food > 0 {
+					food--
+				} else {
+					water--
+				}
+			}
+			commands = append(commands, fmt.Sprintf("buy food:%d water:%d", food, water))
+			s, _ = m.purchase(s, int(v.buyFood), int(v.buyWater))
+		}
+		s.shopped = true
+		v = m.solve(s)
+	}
+	switch {
+	case v.action == actionStay:
+		commands = append(commands, "stay")
+	case v.action == actionMine:
+		commands = append(commands, "mine")
+	case v.action >= 0:
+		commands = append(commands, "go "+m.ids[v.action])
+	}
+	return commands
+}
+
+func commandMDP(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	target, unit, bucket, step := a.float("survival"), a.integer("unit"), a.integer("bucket"), a.integer("step")
+	if unit <= 0 || bucket <= 0 || step <= 0 {
+		return fmt.Errorf("unit, bucket and step should be positive")
+	}
+	start := time.Now()
+	solve := func(penalty float64) (*mdpSolver, mdpValue) {
+		solver := newMDPSolver(t, unit, bucket, step, penalty)
+		return solver, solver.rootValue(t)
+	}
+	const tolerance = 1e-9
+	solver, v := solve(0)
+	if v.survival+tolerance < target {
+		low, high := 0.0, 1000.0
+		for v.survival+tolerance < target && high < 1e9 {
+			low, high = high, high*10
+			solver, v = solve(high)
+		}
+		if v.survival+tolerance < target {
+			return fmt.Errorf("Survival probability %.4f can not be reached, best %.4f", target, v.survival)
+		}
+		for i := 0; i < 8; i++ {
+			mid := (low + high) / 2
+			s, value := solve(mid)
+			if value.survival+tolerance >= target {
+				high, solver, v = mid, s, value
+			} else {
+				low = mid
+			}
+		}
+	}
+	fmt.Printf("Death penalty: %.2f\n", solver.penalty)
+	fmt.Printf("Expected final money: %.2f\n", float64(solver.floorMoney(t.money))+v.value+solver.penalty*(1-v.survival))
+	fmt.Printf("Survival probability: %.4f\n", v.survival)
+	fmt.Printf("States explored: %d in %s\n", solver.explored(), time.Since(start))
+	registerPolicy("mdp", solver)
+	return nil
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	lpTolerance = 1e-5
+	// lpBigBound boxes variables unbounded above, so that the all slack basis
+	// starts dual feasible
+	lpBigBound     = 1e8
+	lpPerturbation = 1e-9
+	// once an integral solution is found, search dives from one in
+	// bbDiveEvery nodes for better ones and expands the rest best bound first
+	bbDiveEvery = 8
+)
+
+// simplex is a dense tableau of bounded dual simplex method minimizing cost.
+// Each row owns a slack variable, making the slack basis the starting one.
+type simplex struct {
+	rows    int
+	columns int
+	tab     [][]float64 // B^-1 [A I]
+	rhs     []float64
+	basis   []int
+	value   []float64
+	lower   []float64
+	upper   []float64
+	cost    []float64 // original cost of variables
+	reduced []float64 // reduced cost
+	atUpper []bool    // nonbasic variable sits at upper bound
+	isBasic []bool
+	nonzero []int // scratch space for nonzero columns of pivot row
+	pivots  int
+}
+
+func newSimplex(model *lpModel) *simplex {
+	m, nv := len(model.rows), len(model.variables)
+	s := &simplex{
+		rows:    m,
+		columns: nv + m,
+		tab:     make([][]float64, m),
+		rhs:     make([]float64, m),
+		basis:   make([]int, m),
+		value:   make([]float64, nv+m),
+		lower:   make([]float64, nv+m),
+		upper:   make([]float64, nv+m),
+		cost:    make([]float64, nv+m),
+		reduced: make([]float64, nv+m),
+		atUpper: make([]bool, nv+m),
+		isBasic: make([]bool, nv+m),
+	}
+	for j, v := range model.variables {
+		s.lower[j], s.upper[j] = v.lower, math.Min(v.upper, lpBigBound)
+	}
+	for _, term := range model.objective {
+		s.cost[term.index] -= term.coef
+	}
+	copy(s.reduced, s.cost)
+	for j := 0; j < nv; j++ {
+		s.atUpper[j] = s.reduced[j] < 0 && s.lower[j] < s.upper[j]
+		s.value[j] = s.lower[j]
+		// perturbing cost breaks ties among ratios, which would let the
+		// mostly zero cost of model cycle
+		perturb := lpPerturbation * (1 + float64(j*7919%1000)/1000)
+		if s.atUpper[j] {
+			s.value[j] = s.upper[j]
+			s.reduced[j] -= perturb
+		} else {
+			s.reduced[j] += perturb
+		}
+	}
+	for i, row := range model.rows {
+		s.tab[i] = make([]float64, nv+m)
+		slack := nv + i
+		s.tab[i][slack] = 1
+		s.basis[i] = slack
+		s.isBasic[slack] = true
+		activity := 0.0
+		for _, term := range row.terms {
+			s.tab[i][term.index] += term.coef
+			activity += term.coef * s.value[term.index]
+		}
+		s.value[slack] = row.rhs - activity
+		s.rhs[i] = row.rhs
+		switch row.sense {
+		case "<=":
+			s.lower[slack], s.upper[slack] = 0, math.Inf(1)
+		case ">=":
+			s.lower[slack], s.upper[slack] = math.Inf(-1), 0
+		}
+	}
+	return s
+}
+
+func (s *simplex) clone() *simplex {
+	c := *s
+	c.tab = make([][]float64, s.rows)
+	for i, row := range s.tab {
+		c.tab[i] = append([]float64(nil), row...)
+	}
+	c.basis = append([]int(nil), s.basis...)
+	c.value = append([]float64(nil), s.value...)
+	c.lower = append([]float64(nil), s.lower...)
+	c.upper = append([]float64(nil), s.upper...)
+	c.reduced = append([]float64(nil), s.reduced...)
+	c.atUpper = append([]bool(nil), s.atUpper...)
+	c.isBasic = append([]bool(nil), s.isBasic...)
+	return &c
+}
+
+func (s *simplex) objective() float64 {
+	total := 0.0
+	for j, c := range s.cost {
+		total += c * s.value[j]
+	}
+	return total
+}
+
+// bound tightens bounds of variable, moving it when it is nonbasic
+func (s *simplex) bound(j int, lower float64, upper float64) {
+	s.lower[j], s.upper[j] = lower, upper
+	if s.isBasic[j] {
+		return
+	}
+	target := lower
+	if (s.atUpper[j] && lower < upper) || s.value[j] > upper {
+		target = upper
+	}
+	s.atUpper[j] = target == upper && lower < upper
+	delta := target - s.value[j]
+	if delta == 0 {
+		return
+	}
+	for i, b := range s.basis {
+		s.value[b] -= s.tab[i][j] * delta
+	}
+	s.value[j] = target
+}
+
+// refresh computes basic values again from nonbasic ones, clearing rounding
+// error accumulated by updates
+func (s *simplex) refresh() {
+	nv := s.columns - s.rows
+	for i, b := range s.basis {
+		x := 0.0
+		for k, rhs := range s.rhs {
+			x += s.tab[i][nv+k] * rhs
+		}
+		for j, a := range s.tab[i] {
+			if a != 0 && !s.isBasic[j] {
+				x -= a * s.value[j]
+			}
+		}
+		s.value[b] = x
+	}
+}
+
+type lpStatus int
+
+const (
+	lpOptimal lpStatus = iota
+	lpInfeasible
+	lpStalled // iterations ran out
+)
+
+// solve runs dual simplex until basis is primal feasible
+func (s *simplex) solve(limit int) lpStatus {
+	s.refresh()
+	for iter := 0; iter < limit; iter++ {
+		if iter%50 == 49 {
+			s.refresh()
+		}
+		// dual steepest edge: infeasibility is scaled by norm of row of B^-1
+		r, worst, target, increase := -1, 0.0, 0.0, false
+		nv := s.columns - s.rows
+		for i, b := range s.basis {
+			d, up := s.lower[b]-s.value[b], true
+			if e := s.value[b] - s.upper[b]; e > d {
+				d, up = e, false
+			}
+			if d <= lpTolerance {
+				continue
+			}
+			norm := 0.0
+			for _, x := range s.tab[i][nv:] {
+				norm += x * x
+			}
+			if score := d * d / norm; score > worst {
+				r, worst, increase = i, score, up
+				target = s.upper[b]
+				if up {
+					target = s.lower[b]
+				}
+			}
+		}
+		if r < 0 {
+			return lpOptimal
+		}
+		enter, best, pivot := -1, math.Inf(1), 0.0
+		for j := 0; j < s.columns; j++ {
+			a := s.tab[r][j]
+			if s.isBasic[j] || math.Abs(a) < 1e-9 || s.lower[j] == s.upper[j] {
+				continue
+			}
+			// moving x_j away from its bound must push basic variable toward target
+			if s.atUpper[j] == ((a < 0) == increase) {
+				continue
+			}
+			ratio := math.Abs(s.reduced[j]) / math.Abs(a)
+			if ratio < best-1e-12 || (ratio < best+1e-12 && math.Abs(a) > math.Abs(pivot)) {
+				enter, best, pivot = j, ratio, a
+			}
+		}
+		if enter < 0 {
+			return lpInfeasible
+		}
+		leave := s.basis[r]
+		theta := (s.value[leave] - target) / pivot
+		for i, b := range s.basis {
+			s.value[b] -= s.tab[i][enter] * theta
+		}
+		s.value[enter] += theta
+		s.value[leave] = target
+		s.atUpper[leave] = target == s.upper[leave] && s.lower[leave] < s.upper[leave]
+		s.atUpper[enter] = false
+
+		row := s.tab[r]
+		nonzero := s.nonzero[:0]
+		for j, x := range row {
+			if x != 0 {
+				row[j] = x / pivot
+				nonzero = append(nonzero, j)
+			}
+		}
+		s.nonzero = nonzero
+		for i := range s.tab {
+			if i == r {
+				continue
+			}
+			if f := s.tab[i][enter]; f != 0 {
+				other := s.tab[i]
+				for _, j := range nonzero {
+					other[j] -= f * row[j]
+				}
+			}
+		}
+		if f := s.reduced[enter]; f != 0 {
+			for _, j := range nonzero {
+				s.reduced[j] -= f * row[j]
+			}
+		}
+		s.basis[r] = enter
+		s.isBasic[leave], s.isBasic[enter] = false, true
+		s.pivots++
+	}
+	return lpStalled
+}
+
+// milpResult is the best integral solution found by branch and bound
+type milpResult struct {
+	values    map[string]float64
+	objective float64
+	bound     float64 // no integral solution is better than it
+	nodes     int
+	optimal   bool
+}
+
+type bbBound struct {
+	index int
+	lower float64
+	upper float64
+}
+
+// bbNode is an open subproblem, kept as bound changes from the root to save
+// memory of tableau
+type bbNode struct {
+	bounds   []bbBound
+	estimate float64 // relaxed objective of parent
+}
+
+type bbQueue []*bbNode
+
+func (q bbQueue) Len() int            { return len(q) }
+func (q bbQueue) Less(i, j int) bool  { return q[i].estimate > q[j].estimate }
+func (q bbQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *bbQueue) Push(x interface{}) { *q = append(*q, x.(*bbNode)) }
+func (q *bbQueue) Pop() interface{} {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
+
+func (n *bbNode) child(index int, lower float64, upper float64, estimate float64) *bbNode {
+	bounds := append(append([]bbBound(nil), n.bounds...), bbBound{index, lower, upper})
+	return &bbNode{bounds: bounds, estimate: estimate}
+}
+
+// branchAndBound solves model by best bound search. Until an integral
+// solution is found, it alternates with the deepest open node and dives from
+// each node into the up branch, later it dives from one in bbDiveEvery
+// nodes. It branches on the fractional variable of the
+// lowest priority and largest value. Nodes are pruned unless their bound beats
+// the best solution by granularity of model.
+func branchAndBound(ctx context.Context, model *lpModel, nodeLimit int) (*milpResult, error) {
+	root := newSimplex(model)
+	result := &milpResult{objective: math.Inf(-1), optimal: true}
+	pruned := func(bound float64) bool {
+		return bound < result.objective+model.granularity-1e-3
+	}
+	// subproblems start from optimal basis of root relaxation
+	switch root.solve(50 * root.columns) {
+	case lpInfeasible:
+		return result, fmt.Errorf("Model is infeasible")
+	case lpStalled:
+		return result, fmt.Errorf("Relaxation is not solved in %d pivots", root.pivots)
+	}
+	// bound of subproblems left unsolved, by stalling or by stopping search
+	unsolved := math.Inf(-1)
+	open := &bbQueue{{estimate: -root.objective()}}
+	for popped := 0; open.Len() > 0; popped++ {
+		var node *bbNode
+		if result.values == nil && popped%2 == 1 {
+			deepest := 0
+			for i, other := range *open {
+				if len(other.bounds) > len((*open)[deepest].bounds) {
+					deepest = i
+				}
+			}
+			node = heap.Remove(open, deepest).(*bbNode)
+		} else {
+			node = heap.Pop(open).(*bbNode)
+		}
+		if pruned(node.estimate) {
+			break
+		}
+		s := root.clone()
+		for _, b := range node.bounds {
+			s.bound(b.index, b.lower, b.upper)
+		}
+		for {
+			if ctx.Err() != nil || result.nodes >= nodeLimit {
+				result.optimal = false
+				unsolved = math.Max(unsolved, node.estimate)
+				for _, other := range *open {
+					unsolved = math.Max(unsolved, other.estimate)
+				}
+				open = &bbQueue{}
+				break
+			}
+			result.nodes++
+			status := s.solve(2 * s.rows)
+			if status == lpStalled {
+				result.optimal = false
+				unsolved = math.Max(unsolved, node.estimate)
+			}
+			if status != lpOptimal {
+				break
+			}
+			bound := -s.objective()
+			if pruned(bound) {
+				break
+			}
+			branch := -1
+			for j, v := range model.variables {
+				if v.kind == lpContinuous {
+					continue
+				}
+				f := s.value[j] - math.Floor(s.value[j])
+				if f <= lpTolerance || f >= 1-lpTolerance {
+					continue
+				}
+				if branch < 0 || v.priority < model.variables[branch].priority ||
+					(v.priority == model.variables[branch].priority && s.value[j] > s.value[branch]) {
+					branch = j
+				}
+			}
+			if branch < 0 {
+				for j, v := range model.variables {
+					if v.upper == math.Inf(1) && s.value[j] >= lpBigBound-1 {
+						return nil, fmt.Errorf("Model is unbounded in variable %s", v.name)
+					}
+				}
+				result.objective = math.Round(bound)
+				result.values = map[string]float64{}
+				for j, v := range model.variables {
+					result.values[v.name] = math.Round(s.value[j]*1e6) / 1e6
+				}
+				break
+			}
+			value, lower, upper := s.value[branch], s.lower[branch], s.upper[branch]
+			heap.Push(open, node.child(branch, lower, math.Floor(value), bound))
+			if result.values != nil && popped%bbDiveEvery != 0 {
+				heap.Push(open, node.child(branch, math.Ceil(value), upper, bound))
+				break
+			}
+			node = node.child(branch, math.Ceil(value), upper, bound)
+			s.bound(branch, math.Ceil(value), upper)
+		}
+	}
+	result.bound = math.Max(result.objective, unsolved)
+	if result.values == nil {
+		if !result.optimal {
+			return result, fmt.Errorf("No integral solution found in %d nodes", result.nodes)
+		}
+		return result, fmt.Errorf("Model is infeasible")
+	}
+	return result, nil
+}
+
+func commandMILP(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	nodeLimit, step := a.integer("nodes"), a.integer("step")
+	if nodeLimit <= 0 || step <= 0 {
+		return fmt.Errorf("nodes and step should be positive")
+	}
+	n, err := t.timeExpanded(step)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	start := time.Now()
+	result, err := branchAndBound(ctx, n.lpModel, nodeLimit)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("MILP: final money %.0f, %d nodes in %s\n", result.objective, result.nodes, time.Since(start))
+	if result.optimal {
+		fmt.Println("Solution is optimal")
+	} else {
+		fmt.Printf("Search stopped, no plan ends with more than %.0f money\n", math.Floor(result.bound+1e-3))
+	}
+	commands, err := n.script(result.values)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		fmt.Println("  " + command)
+	}
+
+	// replaying the plan in game catches differences between model and rules
+	c := t.clone()
+	for _, command := range commands {
+		if err := c.apply(command); err != nil {
+			return fmt.Errorf("Replaying '%s' failed: %v", command, err)
+		}
+	}
+	if !c.finished() || float64(c.money) != result.objective {
+		return fmt.Errorf("Replayed plan ends at '%s' on day %d with money %d, model expects %.0f", c.position, c.date, c.money, result.objective)
+	}
+	fmt.Println("Replayed plan matches model")
+
+	// heuristic of A* has to be admissible for its plan to be optimal
+	search, err := newAStarSearch(t, true, heuristicMap["none"], step)
+	if err != nil {
+		return err
+	}
+	found, err := search.search()
+	if err != nil {
+		return fmt.Errorf("A* finds no plan while MILP does: %v", err)
+	}
+	fmt.Printf("A* with purchase step %d: final money %d\n", step, found.state.money)
+	// relaxation bounds every plan, so beating it means models disagree
+	if bound := math.Floor(result.bound + 1e-3); float64(found.state.money) > bound {
+		return fmt.Errorf("A* ends with money %d above MILP bound %.0f, models disagree", found.state.money, bound)
+	} else if result.optimal && float64(found.state.money) != result.objective {
+		return fmt.Errorf("A* ends with money %d, MILP optimum is %.0f, models disagree", found.state.money, result.objective)
+	}
+	return nil
+}
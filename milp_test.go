@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestMILPMatchesAStar(t *testing.T) {
+	const step = 100
+	// branch and bound cannot prove optimum over whole stages, travelers
+	// start late enough to be solved quickly but early enough to mine
+	for _, c := range []struct {
+		file string
+		date int
+	}{{"stage/stage1.txt", 10}, {"stage/stage2.txt", 12}} {
+		tr := newTraveler(c.file, SimulationConfig{money: -1, firstBuy: true, date: c.date})
+		if tr == nil {
+			t.Fatal("Traveler initialize failed")
+		}
+		n, err := tr.timeExpanded(step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := branchAndBound(context.Background(), n.lpModel, 5000)
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		} else if !result.optimal {
+			t.Fatalf("%s: branch and bound stopped after %d nodes", c.file, result.nodes)
+		}
+		if want := astarMoney(t, tr, "none", step); result.objective != float64(want) {
+			t.Errorf("%s: MILP optimum %.0f, A* optimum %d", c.file, result.objective, want)
+		}
+
+		commands, err := n.script(result.values)
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		replay := tr.clone()
+		for _, command := range commands {
+			if err := replay.apply(command); err != nil {
+				t.Fatalf("%s: replaying '%s': %v", c.file, command, err)
+			}
+		}
+		if !replay.finished() || float64(replay.money) != result.objective {
+			t.Errorf("%s: replayed plan ends at %s with money %d, model expects %.0f", c.file, replay.position, replay.money, result.objective)
+		}
+	}
+}
+
+// TestMILPBoundsAStarFromStart cross-checks whole stages, which branch and
+// bound cannot solve to optimality: A* has to lie between the plan found and
+// the bound proven when search stops
+func TestMILPBoundsAStarFromStart(t *testing.T) {
+	const step = 100
+	for _, c := range []struct {
+		file  string
+		nodes int
+	}{{"stage/stage1.txt", 50}, {"stage/stage2.txt", 80}} {
+		if c.file == "stage/stage2.txt" && testing.Short() {
+			t.Skip("diving into a plan of stage2 takes a minute")
+		}
+		tr := testTraveler(t, c.file)
+		n, err := tr.timeExpanded(step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := branchAndBound(context.Background(), n.lpModel, c.nodes)
+		if err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		want := float64(astarMoney(t, tr, "horizon", step))
+		if result.objective > want || math.Floor(result.bound+1e-3) < want {
+			t.Errorf("%s: A* optimum %.0f is not between MILP plan %.0f and bound %.1f", c.file, want, result.objective, result.bound)
+		}
+	}
+}
+
+// TestMILPZeroWeightPaths solves stage4, where mines and villages are joined
+// by paths of zero weight, walked without spending a day
+func TestMILPZeroWeightPaths(t *testing.T) {
+	const step = 100
+	for position, partner := range map[string]string{"m": "m'", "v'": "v"} {
+		tr := newTraveler("stage/stage4.txt", SimulationConfig{money: -1, position: position, date: 20, food: 200, water: 200})
+		if tr == nil {
+			t.Fatal("Traveler initialize failed")
+		}
+		tr.weatherList = make([]WeatherType, tr.dayCount)
+		for i := range tr.weatherList {
+			tr.weatherList[i] = []WeatherType{sunny, highTemp}[i%2]
+		}
+		n, err := tr.timeExpanded(step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := map[string]int{}
+		for k, id := range n.ids {
+			index[id] = k
+		}
+		name := fmt.Sprintf("y_%d_%d_%d", index[position], index[partner], tr.date)
+		if _, ok := n.index[name]; !ok {
+			t.Errorf("No arc from %s to %s on day %d", position, partner, tr.date)
+		}
+		result, err := branchAndBound(context.Background(), n.lpModel, 5000)
+		if err != nil {
+			t.Fatalf("%s: %v", position, err)
+		} else if want := astarMoney(t, tr, "none", step); result.objective != float64(want) {
+			t.Errorf("%s: MILP optimum %.0f, A* optimum %d", position, result.objective, want)
+		}
+		commands, err := n.script(result.values)
+		if err != nil {
+			t.Fatalf("%s: %v", position, err)
+		}
+		replay := tr.clone()
+		for _, command := range commands {
+			if err := replay.apply(command); err != nil {
+				t.Fatalf("%s: replaying '%s': %v", position, command, err)
+			}
+		}
+		if !replay.finished() || float64(replay.money) != result.objective {
+			t.Errorf("%s: replayed plan ends with money %d, model expects %.0f", position, replay.money, result.objective)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Policy decides what traveler does today from the state it can observe
+type Policy interface {
+	// decide returns action commands for today, empty result means policy has
+	// nothing more to do
+	decide(t *Traveler) []string
+}
+
+var policyMap = map[string]Policy{}
+
+func registerPolicy(name string, p Policy) {
+	policyMap[name] = p
+	fmt.Printf("Policy '%s' registered\n", name)
+}
+
+func policyNames() []string {
+	names := []string{}
+	for name := range policyMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findPolicy(name string) (Policy, error) {
+	p, ok := policyMap[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown policy '%s', available: %s", name, strings.Join(policyNames(), ", "))
+	}
+	return p, nil
+}
+
+// apply runs a single action command on traveler without printing or recording
+func (t *Traveler) apply(command string) error {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return fmt.Errorf("Empty command")
+	}
+	spec, err := findCommand(parts[0])
+	if err != nil {
+		return err
+	}
+	switch spec.name {
+	case "go":
+		for _, id := range parts[1:] {
+			if err := t.moveTo(id); err != nil {
+				return err
+			}
+		}
+	case "stay":
+		if err := t.stay(); err != nil {
+			return err
+		}
+	case "mine":
+		if err := t.mining(); err != nil {
+			return err
+		}
+	case "buy":
+		a, err := spec.parse(parts[1:], t)
+		if err != nil {
+			return err
+		}
+		t.buyResource(a.integer("food"), a.integer("water"))
+	default:
+		return fmt.Errorf("Unknown action `%s`", parts[0])
+	}
+	t.checkState()
+	return nil
+}
+
+// alive reports whether traveler has resource left and is in time
+func (s TravelerState) alive() bool {
+	return s.ok && s.food >= 0 && s.water >= 0
+}
+
+// finished reports whether traveler reached ending alive
+func (t *Traveler) finished() bool {
+	return t.alive() && t.position == t.ending.id
+}
+
+// playPolicy lets policy control traveler until it reaches ending, dies or
+// stops making progress. run is called for each command.
+func playPolicy(t *Traveler, p Policy, run func(string) error) error {
+	for t.alive() && t.position != t.ending.id && t.date < t.dayCount {
+		date, position := t.date, t.position
+		commands := p.decide(t)
+		if len(commands) == 0 {
+			return nil
+		}
+		for _, command := range commands {
+			err := run(command)
+			if err != nil {
+				return err
+			}
+		}
+		if t.date == date && t.position == position {
+			return fmt.Errorf("Policy makes no progress on day %d", date)
+		}
+	}
+	return nil
+}
+
+// policyTrial plays policy from state start under weather drawn from stage's
+// weather model, measuring final money and survival. Weather up to the day of
+// start is kept, only the days after it are drawn.
+func policyTrial(p Policy, start TravelerState) Trial {
+	return func(t *Traveler, rng *rand.Rand) Sample {
+		known := t.Stage.weatherList
+		if len(known) > start.date+1 {
+			known = known[:start.date+1]
+		}
+		t.Stage.weatherList = t.weather().extendList(rng, known, t.dayCount)
+		t.Restore(start)
+		playPolicy(t, p, t.apply)
+		if !t.finished() {
+			return Sample{"money": 0, "survival": 0}
+		}
+		return Sample{"money": float64(t.money), "survival": 1}
+	}
+}
+
+func commandAutoplay(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	p, err := findPolicy(a.str("policy"))
+	if err != nil {
+		return err
+	}
+	return playPolicy(t, p, func(command string) error {
+		return singleCommand(command, strings.Fields(command), t, states)
+	})
+}
+
+func commandPolicies(_ *commandArgs, _ *Traveler, _ *StateRecorder) error {
+	for _, name := range policyNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
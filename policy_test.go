@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// stayPolicy stays every day, remembering weather of the first day it decides
+type stayPolicy struct {
+	first []WeatherType
+}
+
+func (p *stayPolicy) decide(t *Traveler) []string {
+	if t.date < len(t.weatherList) && len(p.first) == 0 {
+		p.first = append(p.first, t.weatherList[t.date])
+	}
+	return []string{"stay"}
+}
+
+func TestPolicyTrialKeepsKnownWeather(t *testing.T) {
+	tr := newTraveler("stage/stage1.txt", SimulationConfig{money: -1, date: 5, food: 200, water: 200})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	tr.weatherList[5] = sandStorm
+	known := append([]WeatherType(nil), tr.weatherList[:6]...)
+	p := &stayPolicy{}
+	trial := policyTrial(p, tr.Snapshot())
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		c := tr.clone()
+		p.first = nil
+		trial(c, rng)
+		if len(c.weatherList) != c.dayCount {
+			t.Fatalf("Trial draws weather of %d days, stage has %d", len(c.weatherList), c.dayCount)
+		}
+		for day, weather := range known {
+			if c.weatherList[day] != weather {
+				t.Fatalf("Weather of day %d changes from %s to %s in trial", day, weather, c.weatherList[day])
+			}
+		}
+		if len(p.first) == 0 || p.first[0] != sandStorm {
+			t.Fatalf("Policy decides today under %v, weather of today is %s", p.first, sandStorm)
+		}
+	}
+}
+
+// TestRobustWorstCaseMatchesRoot plays robust policy under every weather with
+// exactly storms sandstorm days after today and high temperature on the other
+// days, the worst of them ends with the money robust solver guarantees
+func TestRobustWorstCaseMatchesRoot(t *testing.T) {
+	const storms = 1
+	tr := newTraveler("stage/stage1.txt", SimulationConfig{money: -1, date: 18, food: 200, water: 200, position: "m"})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	solver := newRobustSolver(tr, storms, 10, 1000, 5)
+	want := float64(solver.floorMoney(tr.money)) + solver.rootValue(tr).value
+	worst := math.Inf(1)
+	for day := tr.date + 1; day < tr.dayCount; day++ {
+		c := tr.clone()
+		for i := tr.date + 1; i < tr.dayCount; i++ {
+			c.weatherList[i] = highTemp
+		}
+		c.weatherList[day] = sandStorm
+		if err := playPolicy(c, solver, c.apply); err != nil {
+			t.Fatalf("Storm on day %d: %v", day, err)
+		} else if !c.finished() {
+			t.Fatalf("Storm on day %d: traveler dies at '%s' on day %d", day, c.position, c.date)
+		}
+		worst = math.Min(worst, float64(c.money))
+	}
+	if worst != want {
+		t.Errorf("Worst case ends with money %.0f, robust solver guarantees %.0f", worst, want)
+	}
+}
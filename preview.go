@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// confirm asks player a yes or no question, it is nil when nobody can answer
+// and confirm mode rejects walks like strict one
+var confirm func(question string) bool
+
+// movePreview is outcome of walking a route on a copy of traveler
+type movePreview struct {
+	route    []string
+	before   TravelerState
+	after    *Traveler
+	err      error // error stopping the walk on the way
+	hidden   int   // first day of hidden weather, which is taken as worst, -1 for none
+	worst    WeatherType
+	earliest int // earliest day ending can be reached after the walk, -1 for never
+}
+
+// previewMove walks route on a copy of traveler under weather player can see.
+// Hidden weather is taken as the costliest one traveler can walk in, so
+// consumption is on the safe side, though delays of sandstorm are not foreseen.
+func (t *Traveler) previewMove(route []string) *movePreview {
+	p := &movePreview{route: route, before: t.Snapshot(), earliest: -1}
+	p.after, p.hidden, p.worst = t.observedClone()
+	c := p.after
+	for _, id := range route {
+		if p.err = c.moveTo(id); p.err != nil {
+			break
+		}
+	}
+	c.checkState()
+	dist, _ := c.Graph.shortestFrom(c.position, nil)
+	if days, ok := dist[c.ending.id]; ok {
+		p.earliest = c.date + days
+	}
+	return p
+}
+
+// fatal reports whether traveler dies on the way or cannot reach ending in
+// time afterwards
+func (p *movePreview) fatal() bool {
+	return p.err != nil || !p.after.alive() || p.earliest < 0 || p.earliest > p.after.dayCount
+}
+
+func (p *movePreview) String() string {
+	c := p.after
+	lines := []string{fmt.Sprintf(
+		"Preview of go %s: at %s on day %d, food %d -> %d, water %d -> %d",
+		strings.Join(p.route, " "), c.position, c.date, p.before.food, c.food, p.before.water, c.water,
+	)}
+	if p.hidden >= 0 {
+		lines = append(lines, fmt.Sprintf("  weather hidden from day %d on is taken as %s", p.hidden, p.worst))
+	}
+	switch {
+	case p.err != nil:
+		lines = append(lines, "  walk fails: "+p.err.Error())
+	case !c.alive():
+		lines = append(lines, "  traveler does not survive the walk")
+	case p.earliest < 0:
+		lines = append(lines, fmt.Sprintf("  ending %s cannot be reached from %s", c.ending.id, c.position))
+	case p.earliest > c.dayCount:
+		lines = append(lines, fmt.Sprintf("  ending %s is reached on day %d at the earliest, after the last day %d", c.ending.id, p.earliest, c.dayCount))
+	default:
+		lines = append(lines, fmt.Sprintf("  traveler survives and can reach ending %s by day %d", c.ending.id, p.earliest))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkMove previews a walk and decides whether it goes ahead under preview
+// mode of traveler
+func checkMove(t *Traveler, route []string) error {
+	if t.config.preview == previewOff {
+		return nil
+	}
+	p := t.previewMove(route)
+	fmt.Println(p)
+	if !p.fatal() {
+		return nil
+	} else if t.config.preview == previewStrict {
+		return fmt.Errorf("Walk rejected by strict preview")
+	} else if confirm == nil {
+		return fmt.Errorf("Walk rejected, nobody can confirm it")
+	} else if !confirm("Walk anyway? [y/N] ") {
+		return fmt.Errorf("Walk cancelled")
+	}
+	return nil
+}
+
+func commandPreview(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	if a.has("mode") {
+		t.config.preview = previewMap[a.str("mode")]
+	}
+	fmt.Println("Preview of go commands:", t.config.preview)
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// playerMove is an action a player submits for a day of multiplayer game
+type playerMove struct {
+	t      *Traveler
+	action string // commands of the day separated by commas, see dayPlan
+	walked int    // days spent on path of a go not finished yet
+}
+
+// moveResult is where a move leaves a player on the next day
+type moveResult struct {
+	t      *Traveler // copy of traveler of the move
+	plan   []string  // commands taken, stay for an invalid action
+	walked int
+	path   string // node a walk not finished yet leads to
+	err    error  // why action was invalid or stopped on the way
+}
+
+// dayPlan checks commands a player takes in a day, separated by commas:
+// purchases and walks along paths of no day first, then go to a neighbour,
+// stay or mine, which is stay when left out. The plan is tried on a copy of
+// traveler as if player were alone.
+func dayPlan(t *Traveler, command string) ([]string, error) {
+	plan := []string{}
+	for _, part := range strings.Split(command, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			plan = append(plan, part)
+		}
+	}
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("Empty action")
+	}
+	c := t.clone()
+	ended := false
+	for i, step := range plan {
+		parts := strings.Fields(step)
+		spec, err := findCommand(parts[0])
+		if err != nil {
+			return nil, err
+		} else if !spec.mutating {
+			return nil, fmt.Errorf("`%s` is not an action", spec.name)
+		} else if _, err := spec.parse(parts[1:], c); err != nil {
+			return nil, err
+		} else if ended {
+			return nil, fmt.Errorf("`%s` comes after the day ends", step)
+		} else if spec.name == "go" && len(parts) != 2 {
+			return nil, fmt.Errorf("Players walk to one neighbour at a time")
+		}
+		plan[i] = strings.Join(append([]string{spec.name}, parts[1:]...), " ")
+		switch spec.name {
+		case "go":
+			if _, ok := c.nodes[c.position].neighbour[c.nodes[parts[1]]]; !ok {
+				return nil, fmt.Errorf("Node '%s' is not a neighbour of %s", parts[1], c.position)
+			}
+			ended = c.weight(c.position, parts[1]) > 0
+		case "stay", "mine":
+			ended = true
+		}
+		if err := c.apply(step); err != nil {
+			return nil, err
+		}
+	}
+	if !ended {
+		plan = append(plan, "stay")
+	}
+	return plan, nil
+}
+
+// resolveDay resolves moves submitted for the same day together under rules
+// of shared nodes in problem 3: k players walking the same path each consume
+// k times as much, k players mining the same mine split its income, and
+// buying at a village along with others costs twice its usual price. A walk
+// of several days goes on a day at a time, and only players who have walked a
+// path as many days walk it together. Travelers of moves are left as they
+// are, and a player is affected by others only through these rules, so the
+// outcome does not depend on order of moves.
+func resolveDay(moves []playerMove) []moveResult {
+	results := make([]moveResult, len(moves))
+	walks, mines, buys := map[string]int{}, map[string]int{}, map[string]int{}
+	for i, m := range moves {
+		r := &results[i]
+		r.t, r.walked = m.t.clone(), m.walked
+		if m.walked > 0 {
+			r.plan, r.err = walkPlan(m.t, m.action)
+		} else {
+			r.plan, r.err = dayPlan(m.t, m.action)
+		}
+		if r.err != nil {
+			r.plan, r.walked = []string{"stay"}, 0
+		}
+		position, bought := m.t.position, false
+		for _, step := range r.plan {
+			parts := strings.Fields(step)
+			switch parts[0] {
+			case "buy":
+				if !bought && m.t.nodes[position].nodeType == villageNode {
+					buys[position]++
+					bought = true
+				}
+			case "go":
+				if m.t.weight(position, parts[1]) == 0 {
+					position = parts[1]
+				} else if weather, err := m.t.weatherOn(m.t.date); err == nil && (weather != sandStorm || m.t.sandMovable) {
+					walks[walkKey(position, parts[1], r.walked)]++
+				}
+			case "mine":
+				mines[position]++
+			}
+		}
+	}
+	for i := range results {
+		r := &results[i]
+		invalid := r.err != nil
+		for _, step := range r.plan {
+			if err := resolveStep(r.t, step, &r.walked, walks, mines, buys); err != nil {
+				if !invalid {
+					r.err = err
+				}
+				break
+			}
+		}
+		if r.walked > 0 {
+			r.path = strings.Fields(r.plan[len(r.plan)-1])[1]
+		}
+		r.t.checkState()
+	}
+	return results
+}
+
+// walkKey tells walks apart by path and days walked on it, players walk
+// together only when they are at the same point of the same path
+func walkKey(from string, to string, walked int) string {
+	return fmt.Sprintf("%s %s %d", from, to, walked)
+}
+
+// walkPlan checks action of a player on the way, who can only walk on
+func walkPlan(t *Traveler, action string) ([]string, error) {
+	parts := strings.Fields(action)
+	if len(parts) != 2 || parts[0] != "go" {
+		return nil, fmt.Errorf("Player on the way can only go on walking")
+	} else if _, ok := t.nodes[t.position].neighbour[t.nodes[parts[1]]]; !ok {
+		return nil, fmt.Errorf("Node '%s' is not a neighbour of %s", parts[1], t.position)
+	}
+	return []string{action}, nil
+}
+
+func resolveStep(t *Traveler, step string, walked *int, walks, mines, buys map[string]int) error {
+	parts := strings.Fields(step)
+	switch parts[0] {
+	case "buy":
+		spec, _ := findCommand("buy")
+		a, err := spec.parse(parts[1:], t)
+		if err != nil {
+			return err
+		}
+		food, water := a.integer("food"), a.integer("water")
+		base := food*t.resourceBasePrice[resourceFood] + water*t.resourceBasePrice[resourceWater]
+		if !t.firstBuy {
+			base *= 2
+		}
+		t.buyResource(food, water)
+		if buys[t.position] > 1 {
+			t.money -= base
+		}
+	case "go":
+		distance := t.weight(t.position, parts[1])
+		k := walks[walkKey(t.position, parts[1], *walked)]
+		if distance == 0 {
+			return t.moveTo(parts[1])
+		} else if k == 0 {
+			// kept by sandstorm
+			return t.stay()
+		}
+		if err := t.consumeResource(t.walkCost * k); err != nil {
+			return err
+		}
+		t.arrivalDate = t.date
+		t.date++
+		if *walked++; *walked == distance {
+			t.position, *walked = parts[1], 0
+		}
+	case "mine":
+		if err := t.mining(); err != nil {
+			return err
+		}
+		if k := mines[t.position]; k > 1 {
+			t.money -= t.baseIncome - t.baseIncome/k
+		}
+	default:
+		return t.apply(step)
+	}
+	return nil
+}
+
+// commandResolve resolves a day for players all starting as traveler, whose
+// actions are separated by |, and shows where each of them ends up
+func commandResolve(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	moves := []playerMove{}
+	for _, action := range strings.Split(strings.Join(a.list("action"), " "), "|") {
+		moves = append(moves, playerMove{t: t, action: action})
+	}
+	for i, r := range resolveDay(moves) {
+		c := r.t
+		fmt.Printf("Player %d, %s: day %d at %s, food %d, water %d, money %d\n",
+			i+1, strings.Join(r.plan, ", "), c.date, c.position, c.food, c.water, c.money)
+		if r.path != "" {
+			fmt.Printf("  on the way to %s, %d days walked\n", r.path, r.walked)
+		}
+		if r.err != nil {
+			fmt.Printf("  %v\n", r.err)
+		}
+	}
+	return nil
+}
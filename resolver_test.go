@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// resolverTraveler stands at position of stage1 with plenty of resource
+func resolverTraveler(t *testing.T, position string) *Traveler {
+	t.Helper()
+	tr := newTraveler("stage/stage1.txt", SimulationConfig{money: -1, position: position, food: 200, water: 200})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	return tr
+}
+
+func TestResolveCoWalking(t *testing.T) {
+	tr := resolverTraveler(t, "st")
+	cost := tr.walkCost * tr.resourceBaseCost[tr.weatherList[tr.date]][resourceFood]
+	moves := []playerMove{
+		{t: tr, action: "go ed"},
+		{t: tr, action: "go ed"},
+		{t: tr, action: "go ed"},
+		{t: tr, action: "go v"},
+		// a day ahead on the same path, not walking with the others
+		{t: tr, action: "go ed", walked: 1},
+	}
+	want := []int{3 * cost, 3 * cost, 3 * cost, cost, cost}
+	for i, r := range resolveDay(moves) {
+		if r.err != nil {
+			t.Fatalf("Player %d: %v", i+1, r.err)
+		} else if spent := tr.food - r.t.food; spent != want[i] {
+			t.Errorf("Player %d spent food %d, want %d", i+1, spent, want[i])
+		}
+	}
+}
+
+func TestResolveMiningSplit(t *testing.T) {
+	tr := resolverTraveler(t, "m")
+	for k := 1; k <= 3; k++ {
+		moves := []playerMove{}
+		for i := 0; i < k; i++ {
+			moves = append(moves, playerMove{t: tr, action: "mine"})
+		}
+		for i, r := range resolveDay(moves) {
+			if r.err != nil {
+				t.Fatalf("Player %d of %d: %v", i+1, k, r.err)
+			} else if income := r.t.money - tr.money; income != tr.baseIncome/k {
+				t.Errorf("Player %d of %d mining earned %d, want %d", i+1, k, income, tr.baseIncome/k)
+			}
+		}
+	}
+}
+
+func TestResolveCrowdedVillage(t *testing.T) {
+	tr := resolverTraveler(t, "v")
+	alone := resolveDay([]playerMove{{t: tr, action: "buy food:10"}})[0]
+	price := tr.money - alone.t.money
+	crowded := resolveDay([]playerMove{{t: tr, action: "buy food:10"}, {t: tr, action: "buy water:5, buy food:10"}})
+	if paid := tr.money - crowded[0].t.money; paid != 2*price {
+		t.Errorf("Buying along with others costs %d, alone %d", paid, price)
+	}
+	// one player buying twice in a day is not a crowd
+	twice := resolveDay([]playerMove{{t: tr, action: "buy food:10, buy food:10"}})[0]
+	if paid := tr.money - twice.t.money; paid != 2*price {
+		t.Errorf("Buying twice alone costs %d, once %d", paid, price)
+	}
+}
+
+func TestResolveOrderIndependent(t *testing.T) {
+	st, m := resolverTraveler(t, "st"), resolverTraveler(t, "m")
+	moves := []playerMove{
+		{t: st, action: "go ed"},
+		{t: m, action: "mine"},
+		{t: st, action: "buy food:10, go v"},
+		{t: m, action: "mine"},
+		{t: st, action: "go ed"},
+		{t: st, action: "buy water:10, stay"},
+		{t: st, action: "go nowhere"},
+	}
+	forward := resolveDay(moves)
+	reversed := make([]playerMove, len(moves))
+	for i, move := range moves {
+		reversed[len(moves)-1-i] = move
+	}
+	backward := resolveDay(reversed)
+	for i, r := range forward {
+		b := backward[len(moves)-1-i]
+		if r.t.Snapshot() != b.t.Snapshot() || !reflect.DeepEqual(r.plan, b.plan) || r.walked != b.walked || r.path != b.path {
+			t.Errorf("Player %d ends differently when moves are reversed: %+v, %+v", i+1, r.t.Snapshot(), b.t.Snapshot())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// newRobustSolver plans against an adversary choosing weather of each day,
+// which may bring at most storms sandstorm days from today on
+func newRobustSolver(t *Traveler, storms int, unit int, bucket int, step int) *mdpSolver {
+	m := newMDPSolver(t, unit, bucket, step, 0)
+	m.robust = true
+	m.storms = storms
+	m.origin = t.date
+	return m
+}
+
+// worstRoute follows robust plan from traveler's state under the weather chosen
+// by adversary, describing what happens on each day
+func (m *mdpSolver) worstRoute(t *Traveler) []string {
+	var s mdpState
+	if weather, ok := t.observedWeather(t.date); ok {
+		s = m.observe(t, weather)
+	} else {
+		s = m.observe(t, highTemp)
+		s.weather = m.expect(s, highTemp).worst
+		if s.weather == sandStorm {
+			s.storms++
+		}
+	}
+	route := []string{}
+	for {
+		if !s.shopped && !m.canBuy(s) {
+			s.shopped = true
+		}
+		v := m.solve(s)
+		day := fmt.Sprintf("Day %d (%s, money %d): ", s.date, s.weather, s.money)
+		if !s.shopped {
+			if v.action == actionBuy {
+				route = append(route, day+fmt.Sprintf("buy food:%d water:%d at %s",
+					int(v.buyFood)*m.unit, int(v.buyWater)*m.unit, m.ids[s.node]))
+				s, _ = m.purchase(s, int(v.buyFood), int(v.buyWater))
+			}
+			s.shopped = true
+			continue
+		}
+		var move *mdpMove
+		for _, candidate := range m.dayMoves(s) {
+			if candidate.action == v.action {
+				move = &candidate
+				break
+			}
+		}
+		if move == nil {
+			return route
+		}
+		switch {
+		case move.action == actionStay:
+			route = append(route, day+"stay at "+m.ids[s.node])
+		case move.action == actionMine:
+			route = append(route, day+"mine at "+m.ids[s.node])
+		case move.outcome != outcomeSameDay:
+			route = append(route, day+"walk toward "+m.ids[move.action])
+		}
+		switch move.outcome {
+		case outcomeFinish:
+			return append(route, fmt.Sprintf("Day %d: reach %s", move.next.date, m.ending.id))
+		case outcomeDead:
+			return append(route, fmt.Sprintf("Day %d: die", move.next.date))
+		case outcomeNext:
+			prev := s.weather
+			s = move.next
+			s.weather = m.expect(s, prev).worst
+			if s.weather == sandStorm {
+				s.storms++
+			}
+		default:
+			s = move.next
+		}
+	}
+}
+
+func commandRobust(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	storms, unit, bucket, step, runs := a.integer("sandstorm"), a.integer("unit"), a.integer("bucket"), a.integer("step"), a.integer("runs")
+	if unit <= 0 || bucket <= 0 || step <= 0 || runs <= 0 {
+		return fmt.Errorf("unit, bucket, step and runs should be positive")
+	} else if storms < 0 {
+		return fmt.Errorf("Number of sandstorm days should not be negative")
+	}
+	start := time.Now()
+	solver := newRobustSolver(t, storms, unit, bucket, step)
+	v := solver.rootValue(t)
+	fmt.Printf("States explored: %d in %s\n", solver.explored(), time.Since(start))
+	if math.IsInf(v.value, -1) {
+		return fmt.Errorf("No plan survives every weather with at most %d sandstorm days", storms)
+	}
+	fmt.Printf("Guaranteed final money: %.2f\n", float64(solver.floorMoney(t.money))+v.value)
+	fmt.Println("Worst case route:")
+	for _, line := range solver.worstRoute(t) {
+		fmt.Println("  " + line)
+	}
+	registerPolicy("robust", solver)
+
+	expected, err := findPolicy("mdp")
+	if err != nil {
+		expected = newMDPSolver(t, unit, bucket, step, 0)
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	policies := map[string]Policy{"robust": solver, "mdp": expected}
+	compare := map[string]*Summary{}
+	for _, name := range []string{"robust", "mdp"} {
+		summary, err := evaluateBatch(ctx, t, runs, 0, policyTrial(policies[name], t.Snapshot()))
+		if err != nil {
+			return err
+		}
+		compare[name] = summary
+		fmt.Printf("Policy %s: expected money %.2f, survival rate %.2f%%\n",
+			name, summary.mean("money"), summary.mean("survival")*100)
+	}
+	fmt.Printf("Expected money given up for robustness: %.2f\n",
+		compare["mdp"].mean("money")-compare["robust"].mean("money"))
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionLimit  = 1000      // sessions kept at once
+	sessionExpiry = time.Hour // sessions unused this long are dropped
+)
+
+// session is a traveler played over HTTP with its own history. Requests on a
+// session are served one at a time.
+type session struct {
+	mu     sync.Mutex
+	stage  string
+	t      *Traveler
+	states *StateRecorder
+	used   time.Time // last request, guarded by mutex of server
+}
+
+// server keeps stages loaded and sessions played on them
+type server struct {
+	mu       sync.Mutex
+	stages   map[string]*Stage // read only once loaded, sessions copy them
+	sessions map[string]*session
+	nextID   int
+}
+
+type stateJSON struct {
+	Date     int    `json:"date"`
+	Position string `json:"position"`
+	Load     int    `json:"load"`
+	Money    int    `json:"money"`
+	Food     int    `json:"food"`
+	Water    int    `json:"water"`
+	Ok       bool   `json:"ok"`
+	Alive    bool   `json:"alive"`
+	Finished bool   `json:"finished"`
+	Weather  string `json:"weather,omitempty"` // weather of today if visible
+}
+
+type ledgerJSON struct {
+	Command string    `json:"command"`
+	State   stateJSON `json:"state"`
+}
+
+func stateOf(t *Traveler) stateJSON {
+	s := stateJSON{
+		Date: t.date, Position: t.position, Load: t.loadSpace, Money: t.money,
+		Food: t.food, Water: t.water, Ok: t.ok, Alive: t.alive(), Finished: t.finished(),
+	}
+	if weather, ok := t.observedWeather(t.date); ok {
+		s.Weather = weatherNames[weather]
+	}
+	return s
+}
+
+// ledger lists actions taken with the state each of them leads to
+func (s *session) ledger() []ledgerJSON {
+	c := s.t.clone()
+	entries := []ledgerJSON{}
+	for i, command := range s.states.commands[:s.states.currPos] {
+		c.Restore(s.states.states[i+1])
+		entries = append(entries, ledgerJSON{command, stateOf(c)})
+	}
+	return entries
+}
+
+// serve sessions on addr, with stage file loaded as the first stage
+func serve(addr string, stageFile string) error {
+	s := &server{stages: map[string]*Stage{}, sessions: map[string]*session{}}
+	if stage, err := stageFromFile(stageFile); err == nil {
+		s.addStage(stage)
+	}
+	http.HandleFunc("/stages", s.handleStages)
+	http.HandleFunc("/sessions", s.handleSessions)
+	http.HandleFunc("/sessions/", s.handleSession)
+	log.Println("Serving on", addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *server) addStage(stage *Stage) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.stages[id] = stage
+	return id
+}
+
+// handleStages lists stages on GET and loads a stage sent in the format of
+// stage files on POST
+func (s *server) handleStages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		ids := []string{}
+		for id := range s.stages {
+			ids = append(ids, id)
+		}
+		s.mu.Unlock()
+		sort.Slice(ids, func(i, j int) bool { return len(ids[i]) < len(ids[j]) || len(ids[i]) == len(ids[j]) && ids[i] < ids[j] })
+		writeJSON(w, http.StatusOK, map[string][]string{"stages": ids})
+	case http.MethodPost:
+		stage, err := readStage(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err == nil {
+			err = stage.check()
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": s.addStage(stage)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+	}
+}
+
+type sessionRequest struct {
+	Stage      string `json:"stage"`
+	Visibility string `json:"visibility"`
+}
+
+// handleSessions starts a session on a stage at its starting point
+func (s *server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+	request := sessionRequest{Visibility: "full"}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	visibility, ok := visibilityMap[request.Visibility]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Unknown visibility '%s', should be full, today or none", request.Visibility))
+		return
+	}
+	s.mu.Lock()
+	stage, ok := s.stages[request.Stage]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No such stage '%s'", request.Stage))
+		return
+	}
+	// weather list is the only part of stage sessions change
+	own := *stage
+	own.weatherList = append([]WeatherType(nil), stage.weatherList...)
+	t, err := travelerOn(&own, SimulationConfig{money: -1, firstBuy: true, visibility: visibility})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	id := hex.EncodeToString(buf)
+	now := time.Now()
+	s.mu.Lock()
+	s.expire(now)
+	if len(s.sessions) >= sessionLimit {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("Too many sessions, %d at most", sessionLimit))
+		return
+	}
+	s.sessions[id] = &session{stage: request.Stage, t: t, states: newRecorder(t), used: now}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "state": stateOf(t)})
+}
+
+// expire drops sessions unused for sessionExpiry, mutex of server is held
+func (s *server) expire(now time.Time) {
+	for id, ss := range s.sessions {
+		if now.Sub(ss.used) > sessionExpiry {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// handleSession serves /sessions/{id} and its actions, undo, redo and ledger
+func (s *server) handleSession(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions/"), "/"), "/")
+	now := time.Now()
+	s.mu.Lock()
+	s.expire(now)
+	ss, ok := s.sessions[parts[0]]
+	if ok && len(parts) == 1 && r.Method == http.MethodDelete {
+		delete(s.sessions, parts[0])
+	} else if ok {
+		ss.used = now
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No such session '%s'", parts[0]))
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	route := r.Method + " " + strings.Join(parts[1:], "/")
+	switch route {
+	case "GET ":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"stage": ss.stage, "state": stateOf(ss.t)})
+	case "DELETE ":
+		w.WriteHeader(http.StatusNoContent)
+	case "GET ledger":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ledger": ss.ledger()})
+	case "POST undo", "POST redo":
+		move := ss.states.undo
+		if parts[1] == "redo" {
+			move = ss.states.redo
+		}
+		if err := move(ss.t); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"state": stateOf(ss.t)})
+	case "POST actions":
+		var request struct {
+			Command string `json:"command"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		status, err := ss.act(request.Command)
+		if err != nil {
+			writeJSON(w, status, map[string]interface{}{"error": err.Error(), "state": stateOf(ss.t)})
+			return
+		}
+		writeJSON(w, status, map[string]interface{}{"state": stateOf(ss.t)})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("No route %s /sessions/%s", r.Method, strings.Join(parts, "/")))
+	}
+}
+
+// act takes an action as the shell does, without printing. Actions are the
+// mutating commands, checked against their spec.
+func (s *session) act(command string) (int, error) {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("Empty command")
+	}
+	spec, err := findCommand(parts[0])
+	if err != nil {
+		return http.StatusBadRequest, err
+	} else if !spec.mutating {
+		return http.StatusBadRequest, fmt.Errorf("`%s` is not an action", spec.name)
+	} else if _, err := spec.parse(parts[1:], s.t); err != nil {
+		return http.StatusBadRequest, err
+	} else if !s.t.ok {
+		return http.StatusConflict, fmt.Errorf("Traveler not in normal state")
+	}
+	before := s.t.Snapshot()
+	err = s.t.apply(command)
+	s.t.checkState()
+	// days walked before deadline are kept, as in shell
+	if s.t.Snapshot() != before {
+		s.states.appendRecord(s.t)
+		s.states.appendCommand(strings.Join(parts, " "))
+	}
+	if err != nil {
+		return http.StatusConflict, err
+	}
+	return http.StatusOK, nil
+}
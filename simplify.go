@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// neighbourIDs returns ids of nodes reachable from id in one move, both adjacent
+// nodes and nodes with explicit path weight count, as moveTo accepts either one
+func (g *Graph) neighbourIDs(id string) []string {
+	node := g.nodes[id]
+	set := map[string]struct{}{}
+	for neighbour := range node.neighbour {
+		set[neighbour.id] = struct{}{}
+	}
+	for idn := range node.pathWeight {
+		if _, ok := g.nodes[idn]; ok {
+			set[idn] = struct{}{}
+		}
+	}
+	delete(set, id)
+	ids := make([]string, 0, len(set))
+	for idn := range set {
+		ids = append(ids, idn)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// weight returns days of walking needed from id1 to id2
+func (g *Graph) weight(id1 string, id2 string) int {
+	distance, ok := g.nodes[id1].pathWeight[id2]
+	if !ok {
+		distance = 1
+	}
+	return distance
+}
+
+func (g *Graph) sortedIDs() []string {
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// shortestFrom runs dijkstra from source. Nodes in blocked can be reached but
+// never passed through. Among paths with equal distance the one with more hops
+// is prefered, so that detail of original map is kept.
+func (g *Graph) shortestFrom(source string, blocked map[string]bool) (map[string]int, map[string]string) {
+	dist := map[string]int{source: 0}
+	hops := map[string]int{source: 0}
+	prev := map[string]string{}
+	done := map[string]bool{}
+	ids := g.sortedIDs()
+	for {
+		current := ""
+		for _, id := range ids {
+			d, ok := dist[id]
+			if !ok || done[id] {
+				continue
+			}
+			if current == "" || d < dist[current] {
+				current = id
+			}
+		}
+		if current == "" {
+			break
+		}
+		done[current] = true
+		if current != source && blocked[current] {
+			continue
+		}
+		for _, idn := range g.neighbourIDs(current) {
+			d := dist[current] + g.weight(current, idn)
+			old, ok := dist[idn]
+			if !ok || d < old || (d == old && hops[current]+1 > hops[idn] && !done[idn]) {
+				dist[idn] = d
+				hops[idn] = hops[current] + 1
+				prev[idn] = current
+			}
+		}
+	}
+	return dist, prev
+}
+
+// allPairs returns shortest distance between every pair of connected nodes
+func (g *Graph) allPairs() map[string]map[string]int {
+	result := map[string]map[string]int{}
+	for id := range g.nodes {
+		result[id], _ = g.shortestFrom(id, nil)
+	}
+	return result
+}
+
+func tracePath(prev map[string]string, source string, target string) []string {
+	path := []string{target}
+	for id := target; id != source; {
+		id = prev[id]
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+func (g *Graph) isSpecial(id string) bool {
+	return g.nodes[id].nodeType != normalNode
+}
+
+// cutNodes returns normal nodes whose removal separates special nodes from each
+// other, such nodes have to be kept in simplified map for dominance analysis.
+func (g *Graph) cutNodes() []string {
+	cuts := []string{}
+	for _, removed := range g.sortedIDs() {
+		if g.isSpecial(removed) {
+			continue
+		}
+		visited := map[string]bool{removed: true}
+		groups := 0
+		for _, id := range g.sortedIDs() {
+			if visited[id] || !g.isSpecial(id) {
+				continue
+			}
+			groups++
+			stack := []string{id}
+			visited[id] = true
+			for len(stack) > 0 {
+				current := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				for _, idn := range g.neighbourIDs(current) {
+					if !visited[idn] {
+						visited[idn] = true
+						stack = append(stack, idn)
+					}
+				}
+			}
+		}
+		if groups > 1 {
+			cuts = append(cuts, removed)
+		}
+	}
+	return cuts
+}
+
+// simplify collapses map of s to special nodes and cut nodes. Two kept nodes are
+// connected when one of their shortest paths passes no other kept node, and the
+// original node path is recorded as route of that connection.
+func (g *Graph) simplify(s *Stage) *Stage {
+	kept := map[string]bool{}
+	for _, id := range g.sortedIDs() {
+		if g.isSpecial(id) {
+			kept[id] = true
+		}
+	}
+	for _, id := range g.cutNodes() {
+		kept[id] = true
+	}
+	reduced := *s
+	reduced.nodeCount = len(kept)
+	reduced.adjacents = map[string][]string{}
+	reduced.weightMap = map[string]map[string]int{}
+	reduced.routes = map[string]map[string][]string{}
+	reduced.routeWeights = map[string]map[string][]int{}
+	for _, id := range sortedKeys(kept) {
+		reduced.weightMap[id] = map[string]int{}
+		reduced.routes[id] = map[string][]string{}
+		reduced.routeWeights[id] = map[string][]int{}
+	}
+	for _, id := range sortedKeys(kept) {
+		dist, _ := g.shortestFrom(id, nil)
+		direct, prev := g.shortestFrom(id, kept)
+		for _, idn := range sortedKeys(kept) {
+			if idn <= id {
+				continue
+			}
+			d, ok := direct[idn]
+			if !ok || d != dist[idn] {
+				continue
+			}
+			traced := tracePath(prev, id, idn)
+			path, weights := []string{id}, []int{}
+			for i := 1; i < len(traced); i++ {
+				route, hops := g.hops(s, traced[i-1], traced[i])
+				path, weights = append(path, route[1:]...), append(weights, hops...)
+			}
+			reversed := make([]string, len(path))
+			for i, node := range path {
+				reversed[len(path)-1-i] = node
+			}
+			backward := make([]int, len(weights))
+			for i, weight := range weights {
+				backward[len(weights)-1-i] = weight
+			}
+			reduced.adjacents[id] = append(reduced.adjacents[id], idn)
+			reduced.weightMap[id][idn] = d
+			reduced.weightMap[idn][id] = d
+			reduced.routes[id][idn] = path
+			reduced.routes[idn][id] = reversed
+			reduced.routeWeights[id][idn] = weights
+			reduced.routeWeights[idn][id] = backward
+		}
+	}
+	return &reduced
+}
+
+// hops returns original node path between adjacent nodes id1 and id2 with
+// weights of its hops. Routes written without weights have weight of the
+// path spread evenly over their hops.
+func (g *Graph) hops(s *Stage, id1 string, id2 string) ([]string, []int) {
+	route, ok := s.routes[id1][id2]
+	if !ok {
+		return []string{id1, id2}, []int{g.weight(id1, id2)}
+	}
+	weights, ok := s.routeWeights[id1][id2]
+	if !ok || len(weights) != len(route)-1 {
+		distance, n := g.weight(id1, id2), len(route)-1
+		weights = make([]int, n)
+		for i := range weights {
+			weights[i] = distance*(i+1)/n - distance*i/n
+		}
+	}
+	return route, weights
+}
+
+// dailyRoute walks through ids from current state under weather traveler can
+// see, hidden days taken as worst walkable weather, and returns original node
+// traveler stands at by the end of each day. Routes of a simplified stage are
+// walked hop by hop with their own weights, a traveler in the middle of a hop
+// stands at the node it left.
+func (t *Traveler) dailyRoute(ids []string) ([]string, error) {
+	c, _, _ := t.observedClone()
+	days := []string{}
+	for _, id := range ids {
+		if _, ok := c.nodes[id]; !ok {
+			return nil, fmt.Errorf("No such node with id '%s'", id)
+		}
+		route, weights := c.hops(c.Stage, c.position, id)
+		for i, weight := range weights {
+			for walked := 0; walked < weight; c.date++ {
+				weather, err := c.weatherOn(c.date)
+				if err != nil {
+					return days, err
+				}
+				if weather != sandStorm || c.sandMovable {
+					walked++
+				}
+				if walked == weight {
+					days = append(days, route[i+1])
+				} else {
+					days = append(days, route[i])
+				}
+			}
+		}
+		c.position = id
+	}
+	return days, nil
+}
+
+func commandSimplify(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	reduced := t.Graph.simplify(t.Stage)
+	for _, id := range sortedKeys(reduced.routes) {
+		for _, idn := range sortedKeys(reduced.routes[id]) {
+			if id < idn {
+				fmt.Printf("%s - %s (%d): %s\n", id, idn, reduced.weightMap[id][idn], strings.Join(reduced.routes[id][idn], " "))
+			}
+		}
+	}
+	if !a.has("file") {
+		return nil
+	}
+	err := stageToFile(reduced, a.str("file"))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Simplified stage written to:", a.str("file"))
+	return nil
+}
+
+func commandExpand(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	days, err := t.dailyRoute(a.list("node"))
+	for i, id := range days {
+		fmt.Printf("%d: %s\n", t.date+i, id)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDailyRouteHopWeights walks a simplified stage whose only route has hops
+// of weight 1, 3 and 1, after writing and reading it back
+func TestDailyRouteHopWeights(t *testing.T) {
+	text := `
+- day count
+    10
+- load
+    1200
+- base budget
+    10000
+- base income
+    1000
+- weight & base price
+    water:3:5
+    food:2:10
+- base cost
+    sun:water:5
+    sun:food:7
+- special node
+    st:s
+    ed:e
+- adjacent releation
+    st:a,y
+    a:x
+    x:ed
+    y:ed
+- path weight
+    st,a:1
+    a,x:3
+    x,ed:1
+    st,y:5
+    y,ed:6
+- weather
+    sun,sun,sun,sun,sun,sun,sun,sun,sun,sun
+`
+	dir, err := ioutil.TempDir("", "simplify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	original, reduced := filepath.Join(dir, "stage.txt"), filepath.Join(dir, "reduced.txt")
+	if err := ioutil.WriteFile(original, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tr := newTraveler(original, SimulationConfig{money: -1})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	if err := stageToFile(tr.Graph.simplify(tr.Stage), reduced); err != nil {
+		t.Fatal(err)
+	}
+	tr = newTraveler(reduced, SimulationConfig{money: -1})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	} else if _, ok := tr.nodes["a"]; ok {
+		t.Fatalf("Node a is kept in simplified stage")
+	}
+	days, err := tr.dailyRoute([]string{"ed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "a", "a", "x", "ed"}; !reflect.DeepEqual(days, want) {
+		t.Errorf("Traveler stands at %v by end of each day, want %v", days, want)
+	}
+}
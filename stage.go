@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -72,11 +73,19 @@ type Stage struct {
 	resourceWeight    [2]int
 	resourceBasePrice [2]int
 	resourceBaseCost  [3][2]int
+	stayCost          int  // consumption multiplier for staying a day
+	walkCost          int  // consumption multiplier for walking a day
+	mineCost          int  // consumption multiplier for mining a day
+	sandMovable       bool // whether traveler can walk in sandstorm
+	arrivalMining     bool // whether mining is allowed on the day arriving at mine
 	nodeCount         int
 	special           map[string]NodeType
 	adjacents         map[string][]string
 	weightMap         map[string]map[string]int
 	weatherList       []WeatherType
+	weatherModel      *WeatherModel
+	routes            map[string]map[string][]string // original node path between simplified nodes
+	routeWeights      map[string]map[string][]int    // weights of hops along routes
 }
 
 func (s *Stage) String() string {
@@ -84,9 +93,12 @@ func (s *Stage) String() string {
 	fmt.Fprintln(buf, "Day Count:", s.dayCount)
 	fmt.Fprintln(buf, "Load:", s.load)
 	fmt.Fprintln(buf, "Budget:", s.baseBudget)
-	fmt.Fprintln(buf, "Income:", s.baseBudget)
+	fmt.Fprintln(buf, "Income:", s.baseIncome)
 	fmt.Fprintln(buf, "Weight:", s.resourceWeight)
 	fmt.Fprintln(buf, "Price:", s.resourceBasePrice)
+	fmt.Fprintf(buf, "Action Cost: stay %d, walk %d, mine %d\n", s.stayCost, s.walkCost, s.mineCost)
+	fmt.Fprintln(buf, "Walk In SandStorm:", s.sandMovable)
+	fmt.Fprintln(buf, "Mine On Arrival:", s.arrivalMining)
 	return buf.String()
 }
 
@@ -95,7 +107,18 @@ func stageFromFile(filePath string) (*Stage, error) {
 	if err != nil {
 		return nil, err
 	}
-	scanner := bufio.NewScanner(file)
+	defer file.Close()
+	stage, err := readStage(file)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Stage read from file:", filePath)
+	return stage, nil
+}
+
+// readStage parses a stage in the format of stage files
+func readStage(r io.Reader) (*Stage, error) {
+	scanner := bufio.NewScanner(r)
 	scanner.Split(bufio.ScanLines)
 	var (
 		line    string
@@ -108,6 +131,9 @@ func stageFromFile(filePath string) (*Stage, error) {
 	stage.adjacents = map[string][]string{}
 	stage.weightMap = map[string]map[string]int{}
 	stage.weatherList = []WeatherType{}
+	stage.routes = map[string]map[string][]string{}
+	stage.routeWeights = map[string]map[string][]int{}
+	stage.stayCost, stage.walkCost, stage.mineCost = 1, 2, 3
 	for scanner.Scan() {
 		line = strings.TrimSpace(scanner.Text())
 		if len(line) == 0 {
@@ -130,14 +156,52 @@ func stageFromFile(filePath string) (*Stage, error) {
 			return nil, err
 		}
 	}
-	fmt.Println("Stage read from file:", filePath)
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 	return stage, nil
 }
 
+// check reports nodes used by stage but missing from its adjacent relation,
+// and missing starting or ending node, which makeGraph relies on
+func (s *Stage) check() error {
+	known := func(id string) bool {
+		if _, ok := s.adjacents[id]; ok {
+			return true
+		}
+		for _, neighbours := range s.adjacents {
+			for _, n := range neighbours {
+				if n == id {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	kinds := map[NodeType]bool{}
+	for id, kind := range s.special {
+		if !known(id) {
+			return fmt.Errorf("Special node '%s' is not in adjacent relation", id)
+		}
+		kinds[kind] = true
+	}
+	for id := range s.weightMap {
+		if !known(id) {
+			return fmt.Errorf("Node '%s' with path weight is not in adjacent relation", id)
+		}
+	}
+	if !kinds[startingNode] || !kinds[endingNode] {
+		return fmt.Errorf("Stage should have a starting and an ending node")
+	}
+	return nil
+}
+
 func (s *Stage) makeGraph() *Graph {
 	g := newGraph()
 	for id, neighbours := range s.adjacents {
-		g.nodes[id] = newNode(id)
+		if _, ok := g.nodes[id]; !ok {
+			g.nodes[id] = newNode(id)
+		}
 		for _, n := range neighbours {
 			g.appendAdj(id, n)
 		}
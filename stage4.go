@@ -3,86 +3,86 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
+	"strings"
 )
 
-var foodExpect = map[string]map[string]float64{}
-var waterExpect = map[string]map[string]float64{}
+var expectTargets = []string{"v", "m", "ed"}
 
-func randWeather(pSun float64, pHigh float64, pSand float64, dayCount int) []WeatherType {
-	pSand += pHigh
-	pSun /= pSand
-	pHigh /= pSand
-	pSand = 1
-	weatherList := []WeatherType{}
-	var (
-		value   float64
-		weather WeatherType
-	)
-	for i := 0; i < dayCount; i++ {
-		value = rand.Float64()
-		switch {
-		case value < pSun:
-			weather = sunny
-		case value < pHigh:
-			weather = highTemp
-		default:
-			weather = sandStorm
+func randomRun(a *commandArgs, t *Traveler, state *StateRecorder) error {
+	loopCount, workers := a.integer("runs"), a.integer("workers")
+	trial := expectationTrial
+	if a.has("policy") {
+		p, err := findPolicy(a.str("policy"))
+		if err != nil {
+			return err
 		}
-		weatherList = append(weatherList, weather)
+		trial = policyTrial(p, t.Snapshot())
 	}
-	return weatherList
+	ctx, cancel := interruptContext()
+	defer cancel()
+	summary, err := evaluateBatch(ctx, t, loopCount, workers, trial)
+	if err != nil {
+		fmt.Printf("Interrupted after %d runs\n", summary.runs)
+	}
+	if a.has("policy") {
+		fmt.Printf("Policy %s over %d runs\n", a.str("policy"), summary.runs)
+		fmt.Printf("Expected money: %.2f\n", summary.mean("money"))
+		fmt.Printf("Survival rate: %.2f%%\n", summary.mean("survival")*100)
+		return nil
+	}
+	printExpectation(summary, resourceFood)
+	printExpectation(summary, resourceWater)
+	return nil
 }
 
-func randomRun(_ []string, t *Traveler, state *StateRecorder) error {
-	pSun, pHigh, pSand := 0.5, 0.4, 0.1
-	loopCount := 30
-	for i := 0; i < loopCount; i++ {
-		t.Stage.weatherList = randWeather(pSun, pHigh, pSand, 8)
-		for id := range t.Graph.nodes {
-			for _, pos := range []string{"v", "m", "ed"} {
-				resetState(t, id)
-				t.moveTo(pos)
-				addToExpectation(&foodExpect, id, pos, float64(t.food))
-				addToExpectation(&waterExpect, id, pos, float64(t.water))
-
-			}
+// expectationTrial draws a weather sequence and measures resource consumption
+// from every node to each of expectTargets
+func expectationTrial(t *Traveler, rng *rand.Rand) Sample {
+	t.Stage.weatherList = t.weather().sampleList(rng, t.dayCount)
+	sample := Sample{}
+	for id := range t.Graph.nodes {
+		for _, pos := range expectTargets {
+			resetState(t, id)
+			t.moveTo(pos)
+			sample[expectationKey(resourceFood, id, pos)] = float64(-t.food)
+			sample[expectationKey(resourceWater, id, pos)] = float64(-t.water)
 		}
 	}
-	fmt.Println("Food Expectation")
-	for id, special := range foodExpect {
-		fmt.Println(id)
-		for pos, value := range special {
-			value /= float64(loopCount)
-			fmt.Printf("\t%s: %.2f\n", pos, value)
-			foodExpect[id][pos] = value
-		}
+	return sample
+}
+
+func expectationKey(kind ResourceType, id string, pos string) string {
+	return fmt.Sprintf("%d:%s:%s", kind, id, pos)
+}
+
+func printExpectation(summary *Summary, kind ResourceType) {
+	if kind == resourceFood {
+		fmt.Println("Food Expectation")
+	} else {
+		fmt.Println("Water Expectation")
 	}
-	fmt.Println("Water Expectation")
-	for id, special := range waterExpect {
-		fmt.Println(id)
-		for pos, value := range special {
-			value /= float64(loopCount)
-			fmt.Printf("\t%s: %.2f\n", pos, value)
-			waterExpect[id][pos] = value
+	lastID := ""
+	for _, key := range summary.keys() {
+		parts := strings.SplitN(key, ":", 3)
+		if parts[0] != strconv.Itoa(int(kind)) {
+			continue
 		}
+		if parts[1] != lastID {
+			lastID = parts[1]
+			fmt.Println(lastID)
+		}
+		fmt.Printf("\t%s: %.2f\n", parts[2], summary.mean(key))
 	}
-	return nil
 }
 
 func resetState(t *Traveler, pos string) {
-	t.date = 0
-	t.position = pos
-	t.food = 0
-	t.water = 0
-	t.loadSpace = t.Stage.load
-	t.money = t.Stage.baseBudget
-}
-
-func addToExpectation(expectation *map[string]map[string]float64, id string, pos string, value float64) {
-	expMap, ok := (*expectation)[id]
-	if !ok {
-		expMap = map[string]float64{}
-	}
-	expMap[pos] -= value
-	(*expectation)[id] = expMap
+	t.Restore(TravelerState{
+		position:    pos,
+		arrivalDate: -1,
+		loadSpace:   t.Stage.load,
+		money:       t.Stage.baseBudget,
+		ok:          true,
+		firstBuy:    true,
+	})
 }
@@ -18,11 +18,14 @@ func init() {
 	ParserMap["base income"] = parseBaseIncome
 	ParserMap["weight & base price"] = parseWeightAndBasePrice
 	ParserMap["base cost"] = parseBaseCost
+	ParserMap["action cost"] = parseActionCost
 	ParserMap["node count"] = parseNodeCount
 	ParserMap["special node"] = parseSpecial
 	ParserMap["adjacent releation"] = parseAdj
 	ParserMap["weather"] = parseWeather
+	ParserMap["weather model"] = parseWeatherModel
 	ParserMap["path weight"] = parsePathWeight
+	ParserMap["route"] = parseRoute
 }
 
 func parseDayCount(s *Stage, line string) error {
@@ -113,6 +116,33 @@ func parseBaseCost(s *Stage, line string) error {
 	return nil
 }
 
+// parseActionCost reads consumption multipliers of actions and rule toggles,
+// arrival mine allows mining on the day arriving at mine. Rules treat arrival
+// day specially for buying at villages as well, which is deliberately not
+// modeled: traveler buys at a village on any day there, arrival day included.
+func parseActionCost(s *Stage, line string) error {
+	parts := strings.Split(line, ":")
+	if len(parts) != 2 {
+		return errors.New("Wrong Sperator Usage")
+	}
+	var err error
+	switch parts[0] {
+	case "stay":
+		s.stayCost, err = strconv.Atoi(parts[1])
+	case "walk":
+		s.walkCost, err = strconv.Atoi(parts[1])
+	case "mine":
+		s.mineCost, err = strconv.Atoi(parts[1])
+	case "sand move":
+		s.sandMovable, err = strconv.ParseBool(parts[1])
+	case "arrival mine":
+		s.arrivalMining, err = strconv.ParseBool(parts[1])
+	default:
+		err = fmt.Errorf("Unknown action %s", parts[0])
+	}
+	return err
+}
+
 func parseSpecial(s *Stage, line string) error {
 	parts := strings.Split(line, ":")
 	if len(parts) != 2 {
@@ -157,6 +187,39 @@ func parseWeather(s *Stage, line string) error {
 	return nil
 }
 
+func parseWeatherModel(s *Stage, line string) error {
+	parts := strings.Split(line, ":")
+	if len(parts) != 2 {
+		return errors.New("Wrong sperator usage")
+	}
+	p, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return err
+	}
+	if s.weatherModel == nil {
+		s.weatherModel = new(WeatherModel)
+	}
+	kinds := strings.Split(parts[0], ",")
+	weathers := []WeatherType{}
+	for _, kind := range kinds {
+		weather, ok := weatherMap[kind]
+		if !ok {
+			return fmt.Errorf("Unknown weather type %s", kind)
+		}
+		weathers = append(weathers, weather)
+	}
+	switch len(weathers) {
+	case 1:
+		s.weatherModel.initial[weathers[0]] = p
+	case 2:
+		s.weatherModel.transition[weathers[0]][weathers[1]] = p
+		s.weatherModel.markov = true
+	default:
+		return errors.New("Wrong sperator usage")
+	}
+	return nil
+}
+
 func parsePathWeight(s *Stage, line string) error {
 	parts := strings.Split(line, ":")
 	if len(parts) != 2 {
@@ -167,8 +230,8 @@ func parsePathWeight(s *Stage, line string) error {
 		return err
 	}
 	nodeIDs := strings.Split(parts[0], ",")
-	if len(parts) != 2 {
-		return errors.New("Wrong sperator usage")
+	if len(nodeIDs) != 2 {
+		return errors.New("Path weight needs two nodes")
 	}
 	for i := 0; i < 2; i++ {
 		j := 1 - i
@@ -181,3 +244,56 @@ func parsePathWeight(s *Stage, line string) error {
 	}
 	return nil
 }
+
+// parseRoute reads node path between two nodes, optionally followed by
+// weights of its hops
+func parseRoute(s *Stage, line string) error {
+	parts := strings.Split(line, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return errors.New("Wrong sperator usage")
+	}
+	nodeIDs := strings.Split(parts[0], ",")
+	path := strings.Split(parts[1], ",")
+	if len(nodeIDs) != 2 || path[0] != nodeIDs[0] || path[len(path)-1] != nodeIDs[1] {
+		return errors.New("Route does not connect its end nodes")
+	}
+	reversed := make([]string, len(path))
+	for i, id := range path {
+		reversed[len(path)-1-i] = id
+	}
+	for i, route := range [][]string{path, reversed} {
+		routeMap, ok := s.routes[nodeIDs[i]]
+		if !ok {
+			routeMap = map[string][]string{}
+		}
+		routeMap[nodeIDs[1-i]] = route
+		s.routes[nodeIDs[i]] = routeMap
+	}
+	if len(parts) == 2 {
+		return nil
+	}
+	weights := []int{}
+	for _, field := range strings.Split(parts[2], ",") {
+		weight, err := strconv.Atoi(field)
+		if err != nil {
+			return err
+		}
+		weights = append(weights, weight)
+	}
+	if len(weights) != len(path)-1 {
+		return errors.New("Route needs a weight for each hop")
+	}
+	backward := make([]int, len(weights))
+	for i, weight := range weights {
+		backward[len(weights)-1-i] = weight
+	}
+	for i, hops := range [][]int{weights, backward} {
+		weightMap, ok := s.routeWeights[nodeIDs[i]]
+		if !ok {
+			weightMap = map[string][]int{}
+		}
+		weightMap[nodeIDs[1-i]] = hops
+		s.routeWeights[nodeIDs[i]] = weightMap
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var specialNames = map[NodeType]string{}
+var weatherNames = map[WeatherType]string{}
+var resourceNames = map[ResourceType]string{}
+
+func init() {
+	for name, kind := range specialNodeMap {
+		specialNames[kind] = name
+	}
+	for name, kind := range weatherMap {
+		weatherNames[kind] = name
+	}
+	for name, kind := range resourceMap {
+		resourceNames[kind] = name
+	}
+}
+
+// stageToFile writes stage to filePath in the format read by stageFromFile
+func stageToFile(s *Stage, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.write(file)
+}
+
+func (s *Stage) write(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	section := func(name string, lines ...string) {
+		fmt.Fprintf(buf, "- %s\n", name)
+		for _, line := range lines {
+			fmt.Fprintf(buf, "    %s\n", line)
+		}
+	}
+	section("day count", fmt.Sprint(s.dayCount))
+	section("load", fmt.Sprint(s.load))
+	section("base budget", fmt.Sprint(s.baseBudget))
+	section("base income", fmt.Sprint(s.baseIncome))
+	lines := []string{}
+	for _, kind := range []ResourceType{resourceWater, resourceFood} {
+		lines = append(lines, fmt.Sprintf(
+			"%s:%d:%d", resourceNames[kind], s.resourceWeight[kind], s.resourceBasePrice[kind],
+		))
+	}
+	section("weight & base price", lines...)
+	lines = []string{}
+	for _, weather := range []WeatherType{sunny, highTemp, sandStorm} {
+		for _, kind := range []ResourceType{resourceWater, resourceFood} {
+			lines = append(lines, fmt.Sprintf(
+				"%s:%s:%d", weatherNames[weather], resourceNames[kind], s.resourceBaseCost[weather][kind],
+			))
+		}
+	}
+	section("base cost", lines...)
+	section("action cost",
+		fmt.Sprintf("stay:%d", s.stayCost),
+		fmt.Sprintf("walk:%d", s.walkCost),
+		fmt.Sprintf("mine:%d", s.mineCost),
+		fmt.Sprintf("sand move:%t", s.sandMovable),
+		fmt.Sprintf("arrival mine:%t", s.arrivalMining),
+	)
+	if len(s.weatherList) > 0 {
+		lines = []string{}
+		for _, weather := range s.weatherList {
+			lines = append(lines, weatherNames[weather])
+		}
+		section("weather", lines...)
+	}
+	if s.weatherModel != nil {
+		section("weather model", s.weatherModel.lines()...)
+	}
+	section("node count", fmt.Sprint(s.nodeCount))
+	lines = []string{}
+	for _, id := range sortedKeys(s.special) {
+		lines = append(lines, fmt.Sprintf("%s:%s", id, specialNames[s.special[id]]))
+	}
+	section("special node", lines...)
+	lines = []string{}
+	for _, id := range sortedKeys(s.adjacents) {
+		lines = append(lines, fmt.Sprintf("%s:%s", id, strings.Join(s.adjacents[id], ",")))
+	}
+	section("adjacent releation", lines...)
+	lines = []string{}
+	for _, id := range sortedKeys(s.weightMap) {
+		for _, idn := range sortedKeys(s.weightMap[id]) {
+			if id <= idn {
+				lines = append(lines, fmt.Sprintf("%s,%s:%d", id, idn, s.weightMap[id][idn]))
+			}
+		}
+	}
+	section("path weight", lines...)
+	if len(s.routes) > 0 {
+		lines = []string{}
+		for _, id := range sortedKeys(s.routes) {
+			for _, idn := range sortedKeys(s.routes[id]) {
+				if id >= idn {
+					continue
+				}
+				line := fmt.Sprintf("%s,%s:%s", id, idn, strings.Join(s.routes[id][idn], ","))
+				if weights, ok := s.routeWeights[id][idn]; ok {
+					fields := []string{}
+					for _, weight := range weights {
+						fields = append(fields, fmt.Sprint(weight))
+					}
+					line += ":" + strings.Join(fields, ",")
+				}
+				lines = append(lines, line)
+			}
+		}
+		section("route", lines...)
+	}
+	return buf.Flush()
+}
+
+// lines returns the weather model section in the format read by
+// parseWeatherModel
+func (m *WeatherModel) lines() []string {
+	lines := []string{}
+	for _, kind := range []WeatherType{sunny, highTemp, sandStorm} {
+		lines = append(lines, fmt.Sprintf("%s:%g", weatherNames[kind], m.initial[kind]))
+	}
+	for _, from := range []WeatherType{sunny, highTemp, sandStorm} {
+		for _, to := range []WeatherType{sunny, highTemp, sandStorm} {
+			if m.markov {
+				lines = append(lines, fmt.Sprintf(
+					"%s,%s:%g", weatherNames[from], weatherNames[to], m.transition[from][to],
+				))
+			}
+		}
+	}
+	return lines
+}
+
+// replaceSection replaces lines of section name in text of a stage file, or
+// appends the section when text has none. Other lines, blank lines after the
+// section included, are kept as they are.
+func replaceSection(text string, name string, lines []string) string {
+	buf := bytes.NewBufferString("")
+	fmt.Fprintf(buf, "- %s\n", name)
+	for _, line := range lines {
+		fmt.Fprintf(buf, "    %s\n", line)
+	}
+	parts := strings.SplitAfter(text, "\n")
+	start := -1
+	for i, part := range parts {
+		if strings.TrimSpace(part) == "- "+name {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return text + buf.String()
+	}
+	end := start + 1
+	for i := start + 1; i < len(parts); i++ {
+		line := strings.TrimSpace(parts[i])
+		if strings.HasPrefix(line, "- ") {
+			break
+		} else if line != "" {
+			end = i + 1
+		}
+	}
+	return strings.Join(parts[:start], "") + buf.String() + strings.Join(parts[end:], "")
+}
+
+// sortedKeys returns keys of a map with string keys in ascending order
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
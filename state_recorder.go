@@ -1,37 +1,36 @@
 package main
 
-import (
-	"fmt"
-	"strings"
-)
+import "fmt"
 
 // StateRecorder is a history state for traveling process
 type StateRecorder struct {
-	currPos  int // current position in record stack
-	commands []string
-	states   []Traveler
+	currPos   int // current position in record stack
+	commands  []string
+	states    []TravelerState
+	scenarios [][]WeatherType // weather lists saved by weather-push
+	macros    map[string][]string
+	defining  string // name of macro being defined, commands go to its body
+	depth     int    // number of macros and scripts running
 }
 
 func newRecorder(t *Traveler) *StateRecorder {
-	return &StateRecorder{0, []string{}, []Traveler{*t}}
+	return &StateRecorder{
+		commands: []string{},
+		states:   []TravelerState{t.Snapshot()},
+		macros:   map[string][]string{},
+	}
 }
 
 func (r *StateRecorder) appendRecord(t *Traveler) {
 	r.currPos++
 	if r.currPos < len(r.states) {
-		r.states[r.currPos] = *t
+		r.states[r.currPos] = t.Snapshot()
 	} else {
-		r.states = append(r.states, *t)
+		r.states = append(r.states, t.Snapshot())
 	}
 }
 
 func (r *StateRecorder) appendCommand(command string) {
-	skipPrefix := []string{"redo", "undo", "history", "log"}
-	for _, prefix := range skipPrefix {
-		if strings.HasPrefix(command, prefix) {
-			return
-		}
-	}
 	if r.currPos > 0 && r.currPos-1 < len(r.commands) {
 		r.commands[r.currPos-1] = command
 	} else {
@@ -92,13 +91,30 @@ func (r *StateRecorder) redoToDate(t *Traveler, date int) error {
 }
 
 func (r *StateRecorder) readState(t *Traveler) {
-	old := r.states[r.currPos]
-	t.date = old.date
-	t.position = old.position
-	t.loadSpace = old.loadSpace
-	t.money = old.money
-	t.water = old.water
-	t.food = old.food
-	t.ok = old.ok
-	t.firstBuy = old.firstBuy
+	t.Restore(r.states[r.currPos])
+}
+
+// resimulate replays recorded actions from the first state under current
+// weather of traveler, replacing recorded states and moving traveler to the
+// last one. Newer states kept for redo are dropped. It returns a description
+// of each action which fails or brings traveler into error state.
+func (r *StateRecorder) resimulate(t *Traveler) []string {
+	if len(r.commands) < r.currPos {
+		r.currPos = len(r.commands)
+	}
+	r.states = r.states[:r.currPos+1]
+	r.commands = r.commands[:r.currPos]
+	t.Restore(r.states[0])
+	problems := []string{}
+	for i, command := range r.commands {
+		date, alive := t.date, t.alive()
+		err := t.apply(command)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%d: %s on day %d fails: %v", i+1, command, date, err))
+		} else if !t.alive() && alive {
+			problems = append(problems, fmt.Sprintf("%d: %s on day %d leaves traveler in error state", i+1, command, date))
+		}
+		r.states[i+1] = t.Snapshot()
+	}
+	return problems
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sweepParams maps names of stage parameters to their storage in a stage
+var sweepParams = map[string]func(s *Stage) *int{
+	"load":         func(s *Stage) *int { return &s.load },
+	"budget":       func(s *Stage) *int { return &s.baseBudget },
+	"income":       func(s *Stage) *int { return &s.baseIncome },
+	"weight-food":  func(s *Stage) *int { return &s.resourceWeight[resourceFood] },
+	"weight-water": func(s *Stage) *int { return &s.resourceWeight[resourceWater] },
+	"price-food":   func(s *Stage) *int { return &s.resourceBasePrice[resourceFood] },
+	"price-water":  func(s *Stage) *int { return &s.resourceBasePrice[resourceWater] },
+	"stay":         func(s *Stage) *int { return &s.stayCost },
+	"walk":         func(s *Stage) *int { return &s.walkCost },
+	"mine":         func(s *Stage) *int { return &s.mineCost },
+}
+
+func init() {
+	// base costs are named like cost-sun-water
+	for wName, weather := range weatherMap {
+		for rName, kind := range resourceMap {
+			weather, kind := weather, kind
+			sweepParams["cost-"+wName+"-"+rName] = func(s *Stage) *int {
+				return &s.resourceBaseCost[weather][kind]
+			}
+		}
+	}
+}
+
+type sweepRange struct {
+	name   string
+	values []int
+}
+
+func parseSweepRange(arg string) (*sweepRange, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, fmt.Errorf("Range '%s' should be name:from:to[:step]", arg)
+	}
+	bounds := []int{0, 0, 1}
+	for i, part := range parts[1:] {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = value
+	}
+	from, to, step := bounds[0], bounds[1], bounds[2]
+	if step <= 0 || from > to {
+		return nil, fmt.Errorf("Range '%s' should have positive step and from not above to", arg)
+	}
+	r := &sweepRange{name: parts[0]}
+	for value := from; value <= to; value += step {
+		r.values = append(r.values, value)
+	}
+	return r, nil
+}
+
+// sweepResult is outcome of a solver on stage with swept parameters
+type sweepResult struct {
+	money    float64
+	survival float64
+	route    string // nodes visited under weather list of stage
+}
+
+// routeOf lists starting node and targets of go commands
+func routeOf(start string, commands []string) string {
+	route := []string{start}
+	for _, command := range commands {
+		parts := strings.Fields(command)
+		if len(parts) > 0 && parts[0] == "go" {
+			route = append(route, parts[1:]...)
+		}
+	}
+	return strings.Join(route, " ")
+}
+
+// sweepSolver runs a solver or evaluates a policy on a traveler at the start
+// of a stage with swept parameters
+type sweepSolver func(t *Traveler) (*sweepResult, error)
+
+func astarSweep(step int, heuristic astarHeuristic) sweepSolver {
+	return func(t *Traveler) (*sweepResult, error) {
+		a, err := newAStarSearch(t, true, heuristic, step)
+		if err != nil {
+			return nil, err
+		}
+		found, err := a.search()
+		if err != nil {
+			return &sweepResult{route: "-"}, nil
+		}
+		return &sweepResult{float64(found.state.money), 1, routeOf(t.position, found.commands)}, nil
+	}
+}
+
+// policySweep evaluates policy made for each stage over runs of weather drawn
+// from weather model, route is played under weather list of stage if known
+func policySweep(runs int, makePolicy func(t *Traveler) Policy) sweepSolver {
+	return func(t *Traveler) (*sweepResult, error) {
+		p := makePolicy(t)
+		ctx, cancel := interruptContext()
+		defer cancel()
+		summary, err := evaluateBatch(ctx, t, runs, 0, policyTrial(p, t.Snapshot()))
+		if err != nil {
+			return nil, err
+		}
+		result := &sweepResult{money: summary.mean("money"), survival: summary.mean("survival"), route: "-"}
+		if len(t.weatherList) >= t.dayCount {
+			c := t.clone()
+			commands := []string{}
+			playPolicy(c, p, func(command string) error {
+				commands = append(commands, command)
+				return c.apply(command)
+			})
+			result.route = routeOf(t.position, commands)
+		}
+		return result, nil
+	}
+}
+
+func commandSweep(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	ranges := []*sweepRange{}
+	solverName, runs, step, csvPath := a.str("solver"), a.integer("runs"), a.integer("step"), a.str("csv")
+	for _, arg := range a.list("range") {
+		if _, ok := sweepParams[strings.Split(arg, ":")[0]]; !ok {
+			return fmt.Errorf("Unknown parameter '%s'", strings.Split(arg, ":")[0])
+		}
+		r, err := parseSweepRange(arg)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) > 2 {
+		return fmt.Errorf("Sweep one or two parameters, like load:800:1400:100")
+	} else if runs <= 0 || step < 0 {
+		return fmt.Errorf("runs should be positive and step not negative")
+	}
+
+	var solver sweepSolver
+	switch solverName {
+	case "astar":
+		if step == 0 {
+			step = 20
+		}
+		solver = astarSweep(step, heuristicMap[a.str("heuristic")])
+	case "mdp":
+		if step == 0 {
+			step = 5
+		}
+		solver = policySweep(runs, func(c *Traveler) Policy {
+			return newMDPSolver(c, 10, 1000, step, 0)
+		})
+	default:
+		p, err := findPolicy(solverName)
+		if err != nil {
+			return fmt.Errorf("Solver should be astar, mdp or a policy: %v", err)
+		}
+		solver = policySweep(runs, func(*Traveler) Policy { return p })
+	}
+
+	// a single value stands for the missing second parameter
+	if len(ranges) == 1 {
+		ranges = append(ranges, &sweepRange{values: []int{0}})
+	}
+	header := []string{ranges[0].name}
+	if ranges[1].name != "" {
+		header = append(header, ranges[1].name)
+	}
+	header = append(header, "money", "survival", "route")
+	rows := [][]string{header}
+	fmt.Println(strings.Join(header, "\t"))
+	for _, first := range ranges[0].values {
+		for _, second := range ranges[1].values {
+			c := t.clone()
+			*sweepParams[ranges[0].name](c.Stage) = first
+			row := []string{strconv.Itoa(first)}
+			if ranges[1].name != "" {
+				*sweepParams[ranges[1].name](c.Stage) = second
+				row = append(row, strconv.Itoa(second))
+			}
+			// runs start from starting point with budget and load of the stage
+			resetState(c, c.starting.id)
+			result, err := solver(c)
+			if err != nil {
+				return err
+			}
+			row = append(row, fmt.Sprintf("%.2f", result.money), fmt.Sprintf("%.4f", result.survival), result.route)
+			rows = append(rows, row)
+			fmt.Println(strings.Join(row, "\t"))
+		}
+	}
+	if csvPath == "" {
+		return nil
+	}
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	fmt.Println("Sweep written to:", csvPath)
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+// makeRaw is only supported on linux, other systems read plain lines
+func makeRaw(fd int) (func(), error) {
+	return nil, fmt.Errorf("Line editing is not supported on this system")
+}
@@ -6,40 +6,116 @@ import (
 	"log"
 )
 
+// SimulationConfig is initial state and rule switches used to build a traveler,
+// so that travelers with different settings can live in one process
+type SimulationConfig struct {
+	inverse    bool   // inverse traveling process, cumulate resource from current place
+	position   string // empty string means starting node of graph
+	date       int
+	money      int // negative value means using base budget of stage
+	food       int
+	water      int
+	firstBuy   bool
+	prune      bool // let solvers skip moves to dominated nodes
+	visibility Visibility
+	preview    PreviewMode
+}
+
+// TravelerState is mutable game state of a traveler. It holds no pointer, so
+// copying it is cheap and snapshots never share data with live traveler.
+type TravelerState struct {
+	date        int
+	position    string
+	arrivalDate int // last day walking to current position, see mining
+	loadSpace   int // load space left for resource
+	money       int
+	water       int
+	food        int
+	ok          bool // wheather traveler is in a normal state
+	firstBuy    bool
+}
+
 // Traveler is object that record traveling state, like position, date, resource
 type Traveler struct {
 	*Stage
 	*Graph
-	date          int
-	position      string
-	loadSpace     int // load space left for resource
-	money         int
-	water         int
-	food          int
-	ok            bool // wheather traveler is in a normal state
-	firstBuy      bool
+	TravelerState
+	config        SimulationConfig
+	dominance     *Dominance // nil when pruning is disabled
 	heuristicFunc func(*Traveler) string
 }
 
-func newTraveler(stageFile string) *Traveler {
+func newTraveler(stageFile string, config SimulationConfig) *Traveler {
 	stage, err := stageFromFile(stageFile)
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
+	t, err := travelerOn(stage, config)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return t
+}
+
+// travelerOn makes a traveler on stage, which is owned by traveler afterwards
+func travelerOn(stage *Stage, config SimulationConfig) (*Traveler, error) {
+	if err := stage.check(); err != nil {
+		return nil, err
+	}
 	graph := stage.makeGraph()
-	return &Traveler{
-		Stage:     stage,
-		Graph:     graph,
-		date:      0,
-		position:  graph.starting.id,
-		loadSpace: stage.load,
-		money:     stage.baseBudget,
-		water:     0,
-		food:      0,
-		ok:        true,
-		firstBuy:  true,
+	position := config.position
+	if position == "" {
+		position = graph.starting.id
+	} else if _, ok := graph.nodes[position]; !ok {
+		return nil, fmt.Errorf("No such node with id '%s'", position)
 	}
+	money := config.money
+	if money < 0 {
+		money = stage.baseBudget
+	}
+	var dominance *Dominance
+	if config.prune {
+		dominance = graph.dominance()
+	}
+	return &Traveler{
+		Stage: stage,
+		Graph: graph,
+		TravelerState: TravelerState{
+			date:        config.date,
+			position:    position,
+			arrivalDate: config.date - 1,
+			loadSpace:   stage.load - config.food*stage.resourceWeight[resourceFood] - config.water*stage.resourceWeight[resourceWater],
+			money:       money,
+			water:       config.water,
+			food:        config.food,
+			ok:          true,
+			firstBuy:    config.firstBuy,
+		},
+		config:    config,
+		dominance: dominance,
+	}, nil
+}
+
+// Snapshot returns current game state of traveler
+func (t *Traveler) Snapshot() TravelerState {
+	return t.TravelerState
+}
+
+// Restore sets game state of traveler to a snapshot
+func (t *Traveler) Restore(state TravelerState) {
+	t.TravelerState = state
+}
+
+// clone returns a copy of traveler with its own stage header, so that weather list
+// of the copy can be replaced without touching the original one
+func (t *Traveler) clone() *Traveler {
+	stage := *t.Stage
+	stage.weatherList = append([]WeatherType(nil), t.Stage.weatherList...)
+	c := *t
+	c.Stage = &stage
+	return &c
 }
 
 func (t *Traveler) String() string {
@@ -51,47 +127,127 @@ func (t *Traveler) String() string {
 		state = colorRed + "Error" + colorNone
 	}
 	fmt.Fprintf(buf, "State: %s\n", state)
-	if t.date < 30 {
-		fmt.Fprintf(buf, "Weather Tommorrow: %s\n", t.Stage.weatherList[t.date])
+	if weather, ok := t.observedWeather(t.date); ok {
+		fmt.Fprintf(buf, "Weather Tommorrow: %s\n", weather)
 	}
 	fmt.Fprint(buf, "| Date | Position | Load Space |  Money  | Food | Water |\n")
 	fmt.Fprintf(buf, "|%6d|%10s|%12d|%9d|%6d|%7d|", t.date, t.position, t.loadSpace, t.money, t.food, t.water)
 	return buf.String()
 }
 
+// deadlineExceeded is the game outcome of acting on a day after the last day
+// of stage
+type deadlineExceeded struct {
+	date     int
+	dayCount int
+}
+
+func (e *deadlineExceeded) Error() string {
+	return fmt.Sprintf("Deadline exceeded: day %d is after the last day %d of stage", e.date, e.dayCount-1)
+}
+
+// weatherOn returns weather of day, failing with deadlineExceeded for days
+// after the last day of stage
+func (s *Stage) weatherOn(day int) (WeatherType, error) {
+	if day >= s.dayCount {
+		return 0, &deadlineExceeded{day, s.dayCount}
+	} else if day < 0 || day >= len(s.weatherList) {
+		return 0, fmt.Errorf("Weather of day %d is unknown", day)
+	}
+	return s.weatherList[day], nil
+}
+
+// observedWeather returns weather of day if visibility lets player see it
+func (t *Traveler) observedWeather(day int) (WeatherType, bool) {
+	weather, err := t.weatherOn(day)
+	if err != nil {
+		return 0, false
+	}
+	switch t.config.visibility {
+	case visibleToday:
+		return weather, day <= t.date
+	case visibleNone:
+		return weather, day < t.date
+	}
+	return weather, true
+}
+
+// knowsAllWeather reports whether player can see weather of every day
+func (t *Traveler) knowsAllWeather() bool {
+	return t.config.visibility == visibleFull && len(t.weatherList) >= t.dayCount
+}
+
+// observedClone copies traveler with weather it cannot see replaced by the
+// costliest one it can walk in. It also returns first hidden day, -1 for none.
+func (t *Traveler) observedClone() (*Traveler, int, WeatherType) {
+	c, hidden := t.clone(), -1
+	worst, heaviest := weatherKinds[0], -1
+	for _, weather := range weatherKinds {
+		weight := t.resourceBaseCost[weather][resourceFood]*t.resourceWeight[resourceFood] +
+			t.resourceBaseCost[weather][resourceWater]*t.resourceWeight[resourceWater]
+		if (weather != sandStorm || t.sandMovable) && weight > heaviest {
+			worst, heaviest = weather, weight
+		}
+	}
+	for day := t.date; day < t.dayCount; day++ {
+		if _, ok := t.observedWeather(day); ok {
+			continue
+		}
+		for len(c.weatherList) <= day {
+			c.weatherList = append(c.weatherList, worst)
+		}
+		c.weatherList[day] = worst
+		if hidden < 0 {
+			hidden = day
+		}
+	}
+	return c, hidden, worst
+}
+
 func (t *Traveler) checkState() bool {
 	inTime := (t.date < t.dayCount) || (t.date == t.dayCount && t.position == t.ending.id)
 	t.ok = inTime && t.loadSpace >= 0 // && t.water >= 0 && t.food >= 0
 	return t.ok
 }
 
-func (t *Traveler) stay() bool {
-	t.consumeResource(1)
+func (t *Traveler) stay() error {
+	if err := t.consumeResource(t.stayCost); err != nil {
+		return err
+	}
 	t.date++
-	return true
+	return nil
 }
 
-func (t *Traveler) moveTo(id string) bool {
+// moveTo walks to node id. Running out of days on the way stops traveler
+// there in error state with deadlineExceeded.
+func (t *Traveler) moveTo(id string) error {
 	_, ok := t.nodes[id]
 	if !ok {
-		return false
-	}
-	distance, ok := t.nodes[t.position].pathWeight[id]
-	if !ok {
-		distance = 1
+		return fmt.Errorf("No such node with id '%s'", id)
 	}
+	distance := t.weight(t.position, id)
+	// traveler arrives on the last day spent walking, or today along a zero
+	// weight path, which takes no day
+	arrival := t.date
 	for distance > 0 {
-		if t.weatherList[t.date] == sandStorm {
-			t.consumeResource(1)
+		weather, err := t.weatherOn(t.date)
+		if err != nil {
+			return t.fail(err)
+		}
+		if weather == sandStorm && !t.sandMovable {
+			err = t.consumeResource(t.stayCost)
 		} else {
-			t.consumeResource(2)
+			err = t.consumeResource(t.walkCost)
 			distance--
 		}
+		if err != nil {
+			return err
+		}
+		arrival = t.date
 		t.date++
-		// fmt.Println(t.date, distance)
 	}
-	t.position = id
-	return true
+	t.position, t.arrivalDate = id, arrival
+	return nil
 }
 
 func (t *Traveler) buyResource(foodAmount int, waterAmount int) bool {
@@ -113,22 +269,32 @@ func (t *Traveler) buyResource(foodAmount int, waterAmount int) bool {
 	return true
 }
 
-func (t *Traveler) mining() bool {
+// mining works a day at mine. Without arrivalMining a traveler cannot mine on
+// its arrival day, so after a walk, which spends that day, mining can start at
+// once, while after a zero weight path it has to wait a day.
+func (t *Traveler) mining() error {
 	if t.nodes[t.position].nodeType != mineNode {
-		return false
+		return fmt.Errorf("You have to go to mine to do this")
+	} else if !t.arrivalMining && t.arrivalDate == t.date {
+		return fmt.Errorf("Cannot mine on day %d, the day arriving at mine '%s'", t.date, t.position)
+	}
+	if err := t.consumeResource(t.mineCost); err != nil {
+		return err
 	}
-	t.consumeResource(3)
 	t.money += t.baseIncome
 	t.date++
-	return true
+	return nil
 }
 
-func (t *Traveler) consumeResource(multiplier int) {
-	var weather WeatherType
-	if *isInverse {
-		weather = t.weatherList[t.date-1]
-	} else {
-		weather = t.weatherList[t.date]
+// consumeResource spends resource of today
+func (t *Traveler) consumeResource(multiplier int) error {
+	day := t.date
+	if t.config.inverse {
+		day = t.date - 1
+	}
+	weather, err := t.weatherOn(day)
+	if err != nil {
+		return t.fail(err)
 	}
 	foodCost := t.resourceBaseCost[weather][resourceFood] * multiplier
 	waterCost := t.resourceBaseCost[weather][resourceWater] * multiplier
@@ -137,6 +303,15 @@ func (t *Traveler) consumeResource(multiplier int) {
 	if t.loadSpace < t.Stage.load {
 		t.loadSpace += foodCost*t.resourceWeight[resourceFood] + waterCost*t.resourceWeight[resourceWater]
 	}
+	return nil
+}
+
+// fail puts traveler in error state when err is a game outcome
+func (t *Traveler) fail(err error) error {
+	if _, ok := err.(*deadlineExceeded); ok {
+		t.ok = false
+	}
+	return err
 }
 
 func (t *Traveler) moveWithHeuristic() {
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMiningAfterArrival(t *testing.T) {
+	config := SimulationConfig{money: -1, food: 200, water: 200}
+	tr := newTraveler("stage/stage1.txt", config)
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	for _, id := range []string{"v", "m"} {
+		if err := tr.moveTo(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tr.arrivalDate != tr.date-1 {
+		t.Errorf("Arrived on day %d, last day walking was %d", tr.arrivalDate, tr.date-1)
+	}
+	// walking spent the arrival day, so mining starts at once
+	money := tr.money
+	if err := tr.mining(); err != nil {
+		t.Fatalf("Mining right after walk to mine: %v", err)
+	} else if tr.money != money+tr.baseIncome {
+		t.Errorf("Mining earned %d, want %d", tr.money-money, tr.baseIncome)
+	}
+
+	// a zero weight path arrives today, mining waits a day
+	config.position = "m"
+	tr = newTraveler("stage/stage4.txt", config)
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	tr.weatherList = []WeatherType{sunny, sunny}
+	if err := tr.moveTo("m'"); err != nil {
+		t.Fatal(err)
+	} else if tr.arrivalDate != tr.date {
+		t.Errorf("Arrived on day %d along zero weight path on day %d", tr.arrivalDate, tr.date)
+	}
+	if err := tr.mining(); err == nil {
+		t.Error("Mined on the day arriving along zero weight path")
+	}
+	if err := tr.stay(); err != nil {
+		t.Fatal(err)
+	} else if err := tr.mining(); err != nil {
+		t.Errorf("Mining the day after arrival: %v", err)
+	}
+}
+
+// TestArrivalMineToggle reads arrival mine of stage, which decides whether
+// traveler can mine on the day arriving along a zero weight path
+func TestArrivalMineToggle(t *testing.T) {
+	content, err := ioutil.ReadFile("stage/stage4.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, allowed := range []bool{false, true} {
+		file, err := ioutil.TempFile("", "stage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		fmt.Fprintf(file, "%s\n- action cost\n    arrival mine:%t\n", content, allowed)
+		file.Close()
+		tr := newTraveler(file.Name(), SimulationConfig{money: -1, food: 200, water: 200, position: "m"})
+		if tr == nil {
+			t.Fatal("Traveler initialize failed")
+		} else if tr.arrivalMining != allowed {
+			t.Fatalf("arrival mine:%t is read as %t", allowed, tr.arrivalMining)
+		}
+		tr.weatherList = []WeatherType{sunny, sunny}
+		if err := tr.moveTo("m'"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.mining(); allowed && err != nil {
+			t.Errorf("Mining on arrival day with arrival mine: %v", err)
+		} else if !allowed && err == nil {
+			t.Errorf("Mined on arrival day without arrival mine")
+		}
+	}
+}
+
+// TestStayPastDeadlineIsRecorded stays beyond the last day, which records the
+// traveler in error state rather than dropping the action
+func TestStayPastDeadlineIsRecorded(t *testing.T) {
+	tr := newTraveler("stage/stage1.txt", SimulationConfig{money: -1, food: 200, water: 200})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	tr.date = tr.dayCount - 1
+	states := newRecorder(tr)
+	for i := 0; i < 2; i++ {
+		if err := singleCommand("stay", []string{"stay"}, tr, states); err != nil {
+			t.Fatalf("Stay %d: %v", i+1, err)
+		}
+	}
+	if len(states.commands) != 2 || states.currPos != 2 {
+		t.Fatalf("History keeps %d commands at position %d, want 2 stays", len(states.commands), states.currPos)
+	}
+	if recorded := states.states[states.currPos]; recorded.ok || recorded.date != tr.dayCount {
+		t.Errorf("Recorded state on day %d is ok %t, want error state on day %d", recorded.date, recorded.ok, tr.dayCount)
+	}
+	if _, late := tr.stay().(*deadlineExceeded); !late {
+		t.Errorf("Staying past the last day does not exceed deadline")
+	}
+}
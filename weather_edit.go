@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// replayHistory re-simulates recorded actions after weather list changes,
+// reporting those which become infeasible
+func replayHistory(t *Traveler, states *StateRecorder) {
+	problems := states.resimulate(t)
+	if len(problems) == 0 {
+		fmt.Println("Recorded actions are still feasible")
+	} else {
+		fmt.Println("Recorded actions infeasible under new weather:")
+		for _, problem := range problems {
+			fmt.Println("  " + problem)
+		}
+	}
+	commandLogState(nil, t, states)
+}
+
+func commandWeatherSet(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	day, weather := a.integer("day"), weatherMap[a.str("weather")]
+	if day < 0 || day >= t.dayCount {
+		return fmt.Errorf("Day should be in [0, %d)", t.dayCount)
+	} else if day > len(t.weatherList) {
+		return fmt.Errorf("Weather is known up to day %d, resample the rest first", len(t.weatherList))
+	}
+	if day == len(t.weatherList) {
+		t.weatherList = append(t.weatherList, weather)
+	} else {
+		t.weatherList[day] = weather
+	}
+	replayHistory(t, states)
+	return nil
+}
+
+// commandWeatherResample draws weather from a day on to the end of stage from
+// weather model, following weather of the day before in Markov model
+func commandWeatherResample(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	from, seed := t.date, time.Now().UnixNano()
+	if a.has("day") {
+		from = a.integer("day")
+	}
+	if a.has("seed") {
+		seed = int64(a.integer("seed"))
+	}
+	if from < 0 || from > len(t.weatherList) || from >= t.dayCount {
+		return fmt.Errorf("Day should be in [0, %d]", len(t.weatherList))
+	}
+	rng := rand.New(rand.NewSource(seed))
+	t.weatherList = t.weather().extendList(rng, t.weatherList[:from], t.dayCount)
+	fmt.Printf("Weather resampled from day %d\n", from)
+	replayHistory(t, states)
+	return nil
+}
+
+func commandWeatherPush(_ *commandArgs, t *Traveler, states *StateRecorder) error {
+	states.scenarios = append(states.scenarios, append([]WeatherType(nil), t.weatherList...))
+	fmt.Printf("Weather scenario saved, %d on stack\n", len(states.scenarios))
+	return nil
+}
+
+func commandWeatherPop(_ *commandArgs, t *Traveler, states *StateRecorder) error {
+	if len(states.scenarios) == 0 {
+		return fmt.Errorf("No saved weather scenario")
+	}
+	last := len(states.scenarios) - 1
+	t.weatherList = states.scenarios[last]
+	states.scenarios = states.scenarios[:last]
+	fmt.Printf("Weather scenario restored, %d on stack\n", len(states.scenarios))
+	replayHistory(t, states)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// weatherCounts is tally of weather days and of consecutive pairs of days
+type weatherCounts struct {
+	days  [3]int
+	pairs [3][3]int
+}
+
+func (c *weatherCounts) add(weatherList []WeatherType) {
+	for i, weather := range weatherList {
+		c.days[weather]++
+		if i > 0 {
+			c.pairs[weatherList[i-1]][weather]++
+		}
+	}
+}
+
+// wilson returns 95% Wilson score interval of probability with k successes
+// in n trials, which stays inside [0, 1] for small samples
+func wilson(k int, n int) (float64, float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	const z = 1.96
+	p, fn := float64(k)/float64(n), float64(n)
+	center := (p + z*z/(2*fn)) / (1 + z*z/fn)
+	half := z / (1 + z*z/fn) * math.Sqrt(p*(1-p)/fn+z*z/(4*fn*fn))
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
+
+// fit estimates weather model from counts. Markov model starts with the
+// frequency of all days, and weather never observed is followed by it as well.
+func (c *weatherCounts) fit(markov bool) *WeatherModel {
+	m := &WeatherModel{markov: markov}
+	total := c.days[0] + c.days[1] + c.days[2]
+	for _, kind := range weatherKinds {
+		m.initial[kind] = float64(c.days[kind]) / float64(total)
+	}
+	for _, from := range weatherKinds {
+		row := c.pairs[from][0] + c.pairs[from][1] + c.pairs[from][2]
+		for _, to := range weatherKinds {
+			if row == 0 {
+				m.transition[from][to] = m.initial[to]
+			} else {
+				m.transition[from][to] = float64(c.pairs[from][to]) / float64(row)
+			}
+		}
+	}
+	return m
+}
+
+func commandFitWeather(a *commandArgs, t *Traveler, _ *StateRecorder) error {
+	files, target, markov := a.list("file"), a.str("write"), a.str("model") == "markov"
+	counts := &weatherCounts{}
+	if len(files) == 0 {
+		counts.add(t.weatherList)
+		fmt.Printf("Current stage: %d days\n", len(t.weatherList))
+	}
+	for _, file := range files {
+		stage, err := stageFromFile(file)
+		if err != nil {
+			return err
+		}
+		counts.add(stage.weatherList)
+		fmt.Printf("%s: %d days\n", file, len(stage.weatherList))
+	}
+	total := counts.days[0] + counts.days[1] + counts.days[2]
+	if total == 0 {
+		return fmt.Errorf("No weather observed to fit")
+	}
+
+	fmt.Printf("\nFrequency over %d days, 95%% interval\n", total)
+	for _, kind := range weatherKinds {
+		low, high := wilson(counts.days[kind], total)
+		fmt.Printf("  %-16s %.3f  [%.3f, %.3f]\n", kind, float64(counts.days[kind])/float64(total), low, high)
+	}
+	fmt.Println("\nTransition, 95% interval")
+	for _, from := range weatherKinds {
+		row := counts.pairs[from][0] + counts.pairs[from][1] + counts.pairs[from][2]
+		if row == 0 {
+			fmt.Printf("  %s is never followed by another day, frequency is used\n", from)
+			continue
+		}
+		for _, to := range weatherKinds {
+			low, high := wilson(counts.pairs[from][to], row)
+			fmt.Printf("  %-16s -> %-16s %.3f  [%.3f, %.3f]  (%d/%d)\n",
+				from, to, float64(counts.pairs[from][to])/float64(row), low, high, counts.pairs[from][to], row)
+		}
+	}
+
+	if target == "" {
+		return nil
+	}
+	// only the weather model section is rewritten, the rest of file is kept
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	if _, err := stageFromFile(target); err != nil {
+		return fmt.Errorf("'%s' is not a stage: %v", target, err)
+	}
+	text := replaceSection(string(content), "weather model", counts.fit(markov).lines())
+	if err := ioutil.WriteFile(target, []byte(text), info.Mode()); err != nil {
+		return err
+	}
+	fmt.Println("\nWeather model written to:", target)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFitWeatherWritesOnlyModel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content, err := ioutil.ReadFile("stage/stage1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := string(content)
+	i := strings.Index(original, "- node count")
+	before, after := original[:i], original[i:]
+	tr := newTraveler("stage/stage1.txt", SimulationConfig{money: -1})
+	if tr == nil {
+		t.Fatal("Traveler initialize failed")
+	}
+	states := newRecorder(tr)
+	counts := &weatherCounts{}
+	counts.add(tr.weatherList)
+	fitted := counts.fit(false)
+	// a model in the middle is replaced, a file without one gets it appended
+	for name, text := range map[string]string{
+		"middle.txt": before + "- weather model\n    sun:1\n    high:0\n    sand:0\n\n" + after,
+		"none.txt":   original,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		command := "fit-weather model:iid write:" + path
+		if err := singleCommand(command, strings.Fields(command), tr, states); err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written := string(content)
+		model := "- weather model\n" + "    " + strings.Join(fitted.lines(), "\n    ") + "\n"
+		want := original + model
+		if name == "middle.txt" {
+			want = before + model + "\n" + after
+		}
+		if written != want {
+			t.Errorf("%s: fit-weather writes\n%s\nwant\n%s", name, written, want)
+		}
+		stage, err := stageFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		} else if stage.weatherModel == nil || stage.weatherModel.initial != fitted.initial {
+			t.Errorf("%s: model read back is %v", name, stage.weatherModel)
+		}
+	}
+}
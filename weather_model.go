@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+)
+
+// WeatherModel is probability model of weather. Without transition table the
+// weather of each day is i.i.d. with probability in initial, otherwise it is a
+// Markov chain starting with initial.
+type WeatherModel struct {
+	initial    [3]float64
+	transition [3][3]float64 // transition[a][b]: probability of b following a
+	markov     bool
+}
+
+var weatherKinds = []WeatherType{highTemp, sunny, sandStorm}
+
+func defaultWeatherModel() *WeatherModel {
+	m := new(WeatherModel)
+	m.initial[sunny], m.initial[highTemp], m.initial[sandStorm] = 0.5, 0.4, 0.1
+	return m
+}
+
+func normalize(p [3]float64) [3]float64 {
+	sum := p[0] + p[1] + p[2]
+	if sum <= 0 {
+		return [3]float64{1.0 / 3, 1.0 / 3, 1.0 / 3}
+	}
+	for i := range p {
+		p[i] /= sum
+	}
+	return p
+}
+
+// first returns distribution of weather on the first day
+func (m *WeatherModel) first() [3]float64 {
+	return normalize(m.initial)
+}
+
+// next returns distribution of weather on the day after a day of weather prev
+func (m *WeatherModel) next(prev WeatherType) [3]float64 {
+	if !m.markov {
+		return m.first()
+	}
+	return normalize(m.transition[prev])
+}
+
+func pick(rng *rand.Rand, p [3]float64) WeatherType {
+	value := rng.Float64()
+	for _, kind := range weatherKinds {
+		if value < p[kind] {
+			return kind
+		}
+		value -= p[kind]
+	}
+	return sandStorm
+}
+
+// sampleList draws weather sequence for dayCount days
+func (m *WeatherModel) sampleList(rng *rand.Rand, dayCount int) []WeatherType {
+	return m.extendList(rng, nil, dayCount)
+}
+
+// extendList keeps weather known and draws the following days up to dayCount,
+// conditioned on the last day known
+func (m *WeatherModel) extendList(rng *rand.Rand, known []WeatherType, dayCount int) []WeatherType {
+	weatherList := append([]WeatherType(nil), known...)
+	for i := len(weatherList); i < dayCount; i++ {
+		if i == 0 {
+			weatherList = append(weatherList, pick(rng, m.first()))
+		} else {
+			weatherList = append(weatherList, pick(rng, m.next(weatherList[i-1])))
+		}
+	}
+	return weatherList
+}
+
+func (m *WeatherModel) String() string {
+	buf := bytes.NewBufferString("")
+	p := m.first()
+	for _, kind := range weatherKinds {
+		fmt.Fprintf(buf, "%s: %.3f\n", kind, p[kind])
+	}
+	if m.markov {
+		for _, from := range weatherKinds {
+			p = m.next(from)
+			for _, to := range weatherKinds {
+				fmt.Fprintf(buf, "%s -> %s: %.3f\n", from, to, p[to])
+			}
+		}
+	}
+	return buf.String()
+}
+
+// weather returns weather model of stage, falling back to default model when
+// stage file has no weather model section
+func (s *Stage) weather() *WeatherModel {
+	if s.weatherModel == nil {
+		return defaultWeatherModel()
+	}
+	return s.weatherModel
+}
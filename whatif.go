@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commandWhatif plays actions separated by commas on a copy of traveler and
+// shows where they lead, leaving traveler and history as they are. Weather
+// hidden from traveler is taken as the worst one it can walk in.
+func commandWhatif(a *commandArgs, t *Traveler, states *StateRecorder) error {
+	c, hidden, worst := t.observedClone()
+	commands, err := expandMacros(strings.Split(strings.Join(a.list("command"), " "), ","), states, 0)
+	if err != nil {
+		return err
+	}
+	if hidden >= 0 {
+		fmt.Printf("Weather hidden from day %d on is taken as %s\n", hidden, worst)
+	}
+	for _, command := range commands {
+		if err := c.apply(command); err != nil {
+			fmt.Printf("'%s' fails: %v\n", command, err)
+			break
+		}
+		fmt.Printf("%s: day %d at %s, food %d, water %d, money %d\n", command, c.date, c.position, c.food, c.water, c.money)
+	}
+	fmt.Println(c.String())
+	return nil
+}
+
+// expandMacros replaces macros among commands by their bodies
+func expandMacros(commands []string, states *StateRecorder, depth int) ([]string, error) {
+	if depth >= macroDepth {
+		return nil, fmt.Errorf("Macros nest deeper than %d", macroDepth)
+	}
+	expanded := []string{}
+	for _, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		body, ok := states.macros[strings.Fields(command)[0]]
+		if !ok {
+			expanded = append(expanded, command)
+			continue
+		}
+		inner, err := expandMacros(body, states, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, inner...)
+	}
+	return expanded, nil
+}
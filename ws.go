@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// wsGUID is appended to key of handshake to get accept value, see RFC 6455
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMessageLimit bounds size of a message peer can send
+const wsMessageLimit = 1 << 20
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsConn is a WebSocket connection carrying text messages. Writes can come
+// from several goroutines, reads from one.
+type wsConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool // clients mask frames they send
+	mu     sync.Mutex
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHas(h http.Header, name string, token string) bool {
+	for _, value := range strings.Split(h.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(value), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsUpgrade takes over an HTTP request asking for WebSocket
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerHas(r.Header, "Connection", "upgrade") ||
+		!headerHas(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "WebSocket handshake expected", http.StatusBadRequest)
+		return nil, fmt.Errorf("Not a WebSocket handshake")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection cannot be taken over", http.StatusInternalServerError)
+		return nil, fmt.Errorf("Connection cannot be taken over")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", wsAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// wsDial opens a WebSocket connection to a ws:// address
+func wsDial(address string) (*wsConn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "ws" {
+		return nil, fmt.Errorf("Only ws:// addresses are supported, got '%s'", address)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake refused: %s", resp.Status)
+	}
+	return &wsConn{conn: conn, r: r, client: true}, nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n < 1<<16:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	if c.client {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		header = append(header, mask...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// readFrame reads a frame and unmasks its payload
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(c.r, header); err != nil {
+		return
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0f
+	masked, size := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(c.r, ext); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(c.r, ext); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext)
+	}
+	if size > wsMessageLimit {
+		err = fmt.Errorf("WebSocket frame of %d bytes is too large", size)
+		return
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err = io.ReadFull(c.r, mask); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// readMessage reads next data message, answering pings on the way. It returns
+// io.EOF once peer closes connection.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		}
+		message = append(message, payload...)
+		if len(message) > wsMessageLimit {
+			return nil, fmt.Errorf("WebSocket message is too large")
+		} else if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) writeJSON(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, data)
+}
+
+func (c *wsConn) readJSON(value interface{}) error {
+	data, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// close sends a close frame and shuts connection down
+func (c *wsConn) close() error {
+	c.writeFrame(wsClose, []byte{0x03, 0xe8}) // normal closure
+	return c.conn.Close()
+}